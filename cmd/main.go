@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"porty-go/config"
 	"porty-go/models"
 	"porty-go/repositories"
 	"porty-go/routes"
+	"porty-go/services"
 	"strings"
 	"time"
 
@@ -49,17 +52,43 @@ func main() {
 		doc = ginSwagger.URL(fmt.Sprintf("http://%s/swagger/doc.json", swaggerHost))
 	}
 
+	// Load the keys tokens are signed and verified with
+	if err := services.LoadSigningKeys(); err != nil {
+		log.Fatal("Failed to load JWT keys: ", err)
+	}
+	if err := services.LoadEncryptionKeys(); err != nil {
+		log.Fatal("Failed to load encryption keys: ", err)
+	}
+	if err := services.LoadCharacterIDKeys(); err != nil {
+		log.Fatal("Failed to load character id keys: ", err)
+	}
+
 	client := config.LoadConfig()
 	repositories.Init(client)
 
+	// Count failed logins in memory or in Mongo when running several instances
+	services.SetAttemptStore(services.NewAttemptStoreFromEnv())
+
+	// Deliver queued emails in the background
+	services.StartOutboxWorker(context.Background(), services.NewMailerFromEnv())
+
+	// Purge the accounts whose deletion grace period is over
+	services.StartAccountPurgeWorker(context.Background())
+
 	r := gin.Default()
 
+	// Only take the client IP from X-Forwarded-For when set by our proxies,
+	// the rate limits and login throttling are keyed on it
+	if err := r.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+
 	// Customize CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     config.AllowedOrigins, // Replace with your frontend URL
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -2,12 +2,20 @@ package config
 
 import (
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
 )
 
+// DiscordEndpoint is the OAuth2 endpoint of Discord
+var DiscordEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://discord.com/oauth2/authorize",
+	TokenURL: "https://discord.com/api/oauth2/token",
+}
+
 func GoogleOAuthConfig() *oauth2.Config {
 	_ = godotenv.Load()
 
@@ -21,3 +29,53 @@ func GoogleOAuthConfig() *oauth2.Config {
 
 	return GoogleOAuthConfig
 }
+
+func GitHubOAuthConfig() *oauth2.Config {
+	_ = godotenv.Load()
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
+		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("GITHUB_REDIRECT_URL"),
+		Scopes:       []string{"read:user", "user:email"},
+		Endpoint:     github.Endpoint,
+	}
+}
+
+func DiscordOAuthConfig() *oauth2.Config {
+	_ = godotenv.Load()
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("DISCORD_CLIENT_ID"),
+		ClientSecret: os.Getenv("DISCORD_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("DISCORD_REDIRECT_URL"),
+		Scopes:       []string{"identify", "email"},
+		Endpoint:     DiscordEndpoint,
+	}
+}
+
+// OIDCOAuthConfig returns the client settings of the generic OpenID Connect
+// provider. The endpoints are left empty, they come from the discovery
+// document of OIDCIssuerURL.
+func OIDCOAuthConfig() *oauth2.Config {
+	_ = godotenv.Load()
+
+	scopes := []string{"openid", "email", "profile"}
+	for _, scope := range strings.Fields(os.Getenv("OIDC_SCOPES")) {
+		if scope != "openid" && scope != "email" && scope != "profile" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       scopes,
+	}
+}
+
+func OIDCIssuerURL() string {
+	_ = godotenv.Load()
+	return strings.TrimSuffix(os.Getenv("OIDC_ISSUER_URL"), "/")
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// TrustedProxies returns the IPs and CIDRs of the reverse proxies allowed to
+// set the client IP through X-Forwarded-For, from the comma separated
+// TRUSTED_PROXIES. None are trusted by default so the client IP is the peer
+// address and cannot be picked by the client.
+func TrustedProxies() []string {
+	_ = godotenv.Load()
+
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"net/http"
+	"porty-go/models"
+	"porty-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListOutboxEmails godoc
+// @Summary List outbox emails
+// @Description List the latest queued emails, optionally filtered by status (pending, sending, sent or dead)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Status"
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/emails [get]
+func ListOutboxEmails(c *gin.Context) {
+	emails, err := services.ListOutboxEmails(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Emails retrieved successfully",
+		Data:    emails,
+	})
+}
+
+// ResendOutboxEmail godoc
+// @Summary Resend an outbox email
+// @Description Queue a failed email again with a fresh retry budget. Sent emails cannot be resent
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Email ID"
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/emails/{id}/resend [post]
+func ResendOutboxEmail(c *gin.Context) {
+	email, err := services.ResendOutboxEmail(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrOutboxEmailNotFound:
+			status = http.StatusNotFound
+		case services.ErrOutboxEmailNotFailed:
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Email queued successfully",
+		Data:    email,
+	})
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+	"porty-go/models"
+	"porty-go/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// getUserClaims extracts the claims set by middleware.JWTAuth, writing an
+// unauthorized response when they are missing
+func getUserClaims(c *gin.Context) (*services.CustomClaims, bool) {
+	userData, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Status:  "error",
+			Message: "User ID not found",
+		})
+		return nil, false
+	}
+
+	// Type assertion to extract user data
+	userClaims, ok := userData.(*services.CustomClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid user data",
+		})
+		return nil, false
+	}
+	return userClaims, true
+}
+
+// getUserObjectID returns the ObjectID of the authenticated user
+func getUserObjectID(c *gin.Context) (primitive.ObjectID, bool) {
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userClaims.UserId)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid user data",
+		})
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"net/http"
+	"porty-go/models"
+	"porty-go/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefreshToken godoc
+// @Summary Refresh the access token
+// @Description Exchange a refresh token for a new access and refresh token. The refresh token is rotated on every use
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body models.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/refresh [post]
+func RefreshToken(c *gin.Context) {
+	var body models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	tokens, err := services.RefreshSession(body.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrInvalidRefreshToken, services.ErrRefreshTokenReused:
+			status = http.StatusUnauthorized
+		case services.ErrEmailNotVerified:
+			status = http.StatusForbidden
+		}
+		c.JSON(status, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Token refreshed successfully",
+		Data:    tokens,
+	})
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the current access token and its session. Pass the refresh token to revoke that session instead
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param logout body models.LogoutRequest false "Refresh token"
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/logout [post]
+func Logout(c *gin.Context) {
+	var body models.LogoutRequest
+	// The body is optional
+	_ = c.ShouldBindJSON(&body)
+
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return
+	}
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	err := services.Logout(userID, userClaims.ID, userClaims.ExpiresAt.Time, body.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Logged out successfully",
+	})
+}
+
+// LogoutAll godoc
+// @Summary Logout from all sessions
+// @Description Revoke every session of the current user, including the current one
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/logout/all [post]
+func LogoutAll(c *gin.Context) {
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return
+	}
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	if err := services.Logout(userID, userClaims.ID, userClaims.ExpiresAt.Time, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := services.LogoutAllSessions(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Logged out from all sessions successfully",
+	})
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use password reset link to the account, if it exists
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param email body models.ForgotPasswordRequest true "Email"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password/forgot [post]
+func ForgotPassword(c *gin.Context) {
+	var body models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := services.RequestPasswordReset(body.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "If the email is registered, a password reset link has been sent",
+	})
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Set a new password with the token of a reset link. Every session of the user is ended
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param reset body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password/reset [post]
+func ResetPassword(c *gin.Context) {
+	var body models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := services.ResetPassword(body.Token, body.Password); err != nil {
+		writePasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Password reset successfully",
+	})
+}
+
+// SetPassword godoc
+// @Summary Set or change the password
+// @Description Set a password for an account registered with Google, or change it by giving the current one.
+// @Description Every other session of the user is ended and new tokens are returned
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param password body models.SetPasswordRequest true "Passwords"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password [post]
+func SetPassword(c *gin.Context) {
+	var body models.SetPasswordRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := services.SetPassword(userID, body.CurrentPassword, body.Password, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		writePasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Password updated successfully",
+		Data:    tokens,
+	})
+}
+
+func writePasswordError(c *gin.Context, err error) {
+	if writeLoginLimitError(c, err) {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch err {
+	case services.ErrInvalidResetToken, services.ErrWeakPassword:
+		status = http.StatusBadRequest
+	case services.ErrCurrentPasswordWrong:
+		status = http.StatusUnauthorized
+	}
+	c.JSON(status, models.ErrorResponse{
+		Status:  "error",
+		Message: err.Error(),
+	})
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Description Send a new email verification link to an unverified account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param email body models.ResendVerificationRequest true "Email"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/verify/resend [post]
+func ResendVerification(c *gin.Context) {
+	var body models.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := services.ResendVerificationEmail(body.Email); err != nil {
+		status := http.StatusInternalServerError
+		if rateErr, ok := err.(*services.VerificationRateLimitError); ok {
+			status = http.StatusTooManyRequests
+			c.Header("Retry-After", strconv.Itoa(int(rateErr.RetryAfter.Seconds())+1))
+		}
+		c.JSON(status, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "If the email is registered and not verified yet, a verification link has been sent",
+	})
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
 	"porty-go/models"
+	"porty-go/repositories"
 	"porty-go/services"
 	"strconv"
 
@@ -17,54 +20,61 @@ func NewCharacterController(service *services.CharacterService) *CharacterContro
 	return &CharacterController{service: service}
 }
 
-// GetAllCharacters godoc
-// @Summary Get all characters
-// @Description Get all characters from the database
+// ListCharacters godoc
+// @Summary List characters
+// @Description Filter, sort and page the characters. List filters take repeated or comma-separated values,
+// @Description sort takes comma-separated fields and a "-" prefix sorts descending
 // @Tags characters
 // @Produce json
-// @Param page query int false "Page number"
-// @Param record query int false "Number of records per page"
-// @Param search query string false "Search term"
-// @Success 200 {array} models.Response
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Characters per page, at most 100" default(10)
+// @Param record query int false "Deprecated, use page_size"
+// @Param search query string false "Search in the name"
+// @Param element query []string false "Elements (Pyro, Hydro, Anemo, Electro, Dendro, Cryo, Geo)"
+// @Param weapon_type query []string false "Weapon types (Sword, Claymore, Polearm, Bow, Catalyst)"
+// @Param rarity query []string false "Rarities (4, 5)"
+// @Param role query []string false "Roles"
+// @Param released_from query string false "Released on or after (YYYY-MM-DD)"
+// @Param released_to query string false "Released on or before (YYYY-MM-DD)"
+// @Param min_attack query int false "Minimum base attack"
+// @Param max_attack query int false "Maximum base attack"
+// @Param min_defense query int false "Minimum base defense"
+// @Param max_defense query int false "Maximum base defense"
+// @Param min_health query int false "Minimum base health"
+// @Param max_health query int false "Maximum base health"
+// @Param sort query string false "Sort fields, e.g. -rarity,name" default(name)
+// @Success 200 {object} models.Response
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /characters [get]
-func (cc *CharacterController) ListAllCharacters(c *gin.Context) {
-	// USE TOKEN
-	// userData, exists := c.Get("user")
-	// if !exists {
-	// 	c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-	// 		Status:  "error",
-	// 		Message: "User ID not found",
-	// 	})
-	// 	return
-	// }
-
-	// // Type assertion to extract user data
-	// userClaims, ok := userData.(*services.CustomClaims)
-	// if !ok {
-	// 	c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-	// 		Status:  "error",
-	// 		Message: "Invalid user data",
-	// 	})
-	// 	return
-	// }
-
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	record, _ := strconv.Atoi(c.DefaultQuery("record", "10"))
-	search := c.DefaultQuery("search", "")
-
-	characters, err := cc.service.ListAllCharacters(page, record, search)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+func (cc *CharacterController) ListCharacters(c *gin.Context) {
+	var query models.CharacterListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
 			Message: err.Error(),
 		})
 		return
 	}
+
+	characters, err := cc.service.ListCharacters(query)
+	if err != nil {
+		writeCharacterError(c, err)
+		return
+	}
+
+	if characters.Page < characters.TotalPages {
+		next := pageLink(c.Request.URL, characters.Page+1)
+		characters.Next = &next
+	}
+	if characters.Page > 1 && characters.TotalPages > 0 {
+		prev := pageLink(c.Request.URL, min(characters.Page-1, characters.TotalPages))
+		characters.Prev = &prev
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Status:  "success",
-		Message: "User created successfully",
+		Message: "Characters retrieved successfully",
 		Data:    characters,
 	})
 }
@@ -74,15 +84,275 @@ func (cc *CharacterController) ListAllCharacters(c *gin.Context) {
 // @Description Get a character by ID from the database
 // @Tags characters
 // @Produce json
-// @Param id path int true "Character ID"
+// @Param id path string true "Character public ID"
 // @Success 200 {object} models.Response
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /characters/{id} [get]
 func (cc *CharacterController) GetCharacterByID(c *gin.Context) {
 	id := c.Param("id")
 
 	character, err := cc.service.GetCharacterByID(id)
+	if err != nil {
+		writeCharacterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Character retrieved successfully",
+		Data:    character,
+	})
+}
+
+// CreateCharacter godoc
+// @Summary Create a character
+// @Description Add a character, admins only
+// @Tags characters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param character body models.Character true "Character"
+// @Success 201 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /characters [post]
+func (cc *CharacterController) CreateCharacter(c *gin.Context) {
+	var character models.Character
+	if err := c.ShouldBindJSON(&character); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	created, err := cc.service.CreateCharacter(character)
+	if err != nil {
+		writeCharacterError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, models.Response{
+		Status:  "success",
+		Message: "Character created successfully",
+		Data:    created,
+	})
+}
+
+// ReplaceCharacter godoc
+// @Summary Replace a character
+// @Description Overwrite every field of a character, admins only
+// @Tags characters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Character public ID"
+// @Param character body models.Character true "Character"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /characters/{id} [put]
+func (cc *CharacterController) ReplaceCharacter(c *gin.Context) {
+	var character models.Character
+	if err := c.ShouldBindJSON(&character); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	updated, err := cc.service.ReplaceCharacter(c.Param("id"), character)
+	if err != nil {
+		writeCharacterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Character updated successfully",
+		Data:    updated,
+	})
+}
+
+// UpdateCharacter godoc
+// @Summary Update a character
+// @Description Change the fields present in the body, admins only
+// @Tags characters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Character public ID"
+// @Param character body models.CharacterPatch true "Fields to update"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /characters/{id} [patch]
+func (cc *CharacterController) UpdateCharacter(c *gin.Context) {
+	var patch models.CharacterPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	updated, err := cc.service.UpdateCharacter(c.Param("id"), patch)
+	if err != nil {
+		writeCharacterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Character updated successfully",
+		Data:    updated,
+	})
+}
+
+// DeleteCharacter godoc
+// @Summary Delete a character
+// @Description Delete a character, admins only
+// @Tags characters
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Character public ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /characters/{id} [delete]
+func (cc *CharacterController) DeleteCharacter(c *gin.Context) {
+	if err := cc.service.DeleteCharacter(c.Param("id")); err != nil {
+		writeCharacterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Character deleted successfully",
+	})
+}
+
+// CompareCharacters godoc
+// @Summary Compare characters
+// @Description Compare the base stats of 2 to 10 characters side by side, with their difference from the first one
+// @Tags characters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body models.CompareCharactersRequest true "Character public IDs"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /characters/compare [post]
+func (cc *CharacterController) CompareCharacters(c *gin.Context) {
+	var body models.CompareCharactersRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	comparison, err := cc.service.CompareCharacters(body.IDs)
+	if err != nil {
+		writeCharacterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Characters compared successfully",
+		Data:    comparison,
+	})
+}
+
+// AnalyzeTeam godoc
+// @Summary Analyze a team
+// @Description Report the element coverage, role balance and base stats of a party of up to 4 characters
+// @Tags characters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body models.AnalyzeTeamRequest true "Character public IDs"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/analyze [post]
+func (cc *CharacterController) AnalyzeTeam(c *gin.Context) {
+	var body models.AnalyzeTeamRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	analysis, err := cc.service.AnalyzeTeam(body.IDs)
+	if err != nil {
+		writeCharacterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Team analyzed successfully",
+		Data:    analysis,
+	})
+}
+
+// ChatWithCharacter godoc
+// @Summary Chat with a character
+// @Description Talk to a character in roleplay. The conversation history is kept per user and character.
+// @Description Use `?stream=true` or `Accept: text/event-stream` to receive the reply as Server-Sent Events
+// @Tags characters
+// @Accept json
+// @Produce json
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param id path string true "Character public ID"
+// @Param stream query bool false "Stream the reply as Server-Sent Events"
+// @Param message body ChatBody true "Message"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.Response
+// @Failure 500 {object} models.ErrorResponse
+// @Router /characters/{id}/chat [post]
+func (cc *CharacterController) ChatWithCharacter(c *gin.Context) {
+	var messageBody ChatBody
+	if err := c.ShouldBindJSON(&messageBody); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+	if messageBody.Message == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: "Message is required!",
+		})
+		return
+	}
+
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	provider, err := services.GetChatProvider()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
@@ -90,9 +360,79 @@ func (cc *CharacterController) GetCharacterByID(c *gin.Context) {
 		})
 		return
 	}
+
+	id := c.Param("id")
+	if wantsStream(c) {
+		streamChat(c, func(onDelta func(delta string) error) (*models.ChatReply, error) {
+			return cc.service.ChatWithCharacter(c.Request.Context(), userID, id, provider, messageBody.Message, onDelta)
+		})
+		return
+	}
+
+	chatResponse, err := cc.service.ChatWithCharacter(c.Request.Context(), userID, id, provider, messageBody.Message, nil)
+	if err != nil {
+		writeConversationError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Status:  "success",
-		Message: "Character retrieved successfully",
-		Data:    character,
+		Message: "Message received",
+		Data:    chatResponse,
+	})
+}
+
+// GetCharacterChat godoc
+// @Summary Get the chat with a character
+// @Description Get the conversation of the current user with a character
+// @Tags characters
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Character public ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /characters/{id}/chat [get]
+func (cc *CharacterController) GetCharacterChat(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	conversation, err := cc.service.GetCharacterChat(userID, c.Param("id"))
+	if err != nil {
+		writeConversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Conversation retrieved successfully",
+		Data:    conversation,
 	})
 }
+
+func writeCharacterError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, repositories.ErrCharacterNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, repositories.ErrInvalidCharacter), errors.Is(err, services.ErrInvalidCharacterQuery),
+		err == services.ErrInvalidCharacterID, err == services.ErrEmptyCharacterPatch, err == services.ErrDuplicateCharacterID:
+		status = http.StatusBadRequest
+	case errors.Is(err, repositories.ErrCharacterConflict):
+		status = http.StatusConflict
+	}
+	c.JSON(status, models.ErrorResponse{
+		Status:  "error",
+		Message: err.Error(),
+	})
+}
+
+// pageLink returns the request path and query with the page replaced
+func pageLink(requestURL *url.URL, page int) string {
+	query := requestURL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return requestURL.Path + "?" + query.Encode()
+}
@@ -3,29 +3,44 @@ package controllers
 import (
 	"net/http"
 	"porty-go/models"
+	"porty-go/repositories"
 	"porty-go/services"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type TestAiBody struct {
-	Message string `json:"message"`
+type ChatBody struct {
+	Message        string `json:"message"`
+	ConversationID string `json:"conversationId"`
 }
 
-// TestAI godoc
-// @Summary Test Chat Bot AI
-// @Description Just Chatbot AI testing
+type RenameConversationBody struct {
+	Title string `json:"title"`
+}
+
+// ChatAi godoc
+// @Summary Chat with the bot
+// @Description Send a message to the chatbot. Omit conversationId to start a new conversation.
+// @Description Use `?stream=true` or `Accept: text/event-stream` to receive the reply as Server-Sent Events
+// @Description (`message` deltas, then `done` with the conversation ID or `error`)
 // @Tags AI
 // @Accept json
 // @Produce json
+// @Produce text/event-stream
 // @Security BearerAuth
-// @Param message body TestAiBody true "Message"
+// @Param stream query bool false "Stream the reply as Server-Sent Events"
+// @Param message body ChatBody true "Message"
 // @Success 200 {object} models.Response
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.Response
 // @Failure 500 {object} models.ErrorResponse
 // @Router /chat [post]
 func ChatAi(c *gin.Context) {
-	var messageBody TestAiBody
+	var messageBody ChatBody
 	if err := c.ShouldBindJSON(&messageBody); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
@@ -41,7 +56,12 @@ func ChatAi(c *gin.Context) {
 		return
 	}
 
-	aiService, err := services.GetServiceOpenAi()
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	provider, err := services.GetChatProvider()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
@@ -50,7 +70,43 @@ func ChatAi(c *gin.Context) {
 		return
 	}
 
-	chatResponse, err := services.GetServiceDialogFlow(1, aiService, messageBody.Message)
+	if wantsStream(c) {
+		streamChat(c, func(onDelta func(delta string) error) (*models.ChatReply, error) {
+			return services.StreamServiceDialogFlow(c.Request.Context(), userID, messageBody.ConversationID, provider, messageBody.Message, onDelta)
+		})
+		return
+	}
+
+	chatResponse, err := services.GetServiceDialogFlow(c.Request.Context(), userID, messageBody.ConversationID, provider, messageBody.Message)
+	if err != nil {
+		writeConversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Message received",
+		Data:    chatResponse,
+	})
+}
+
+// ListConversations godoc
+// @Summary List conversations
+// @Description List the chat conversations of the current user
+// @Tags AI
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /chat/conversations [get]
+func ListConversations(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	conversations, err := services.ListConversations(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
@@ -61,7 +117,218 @@ func ChatAi(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.Response{
 		Status:  "success",
-		Message: "Message received",
-		Data:    chatResponse,
+		Message: "Conversations retrieved successfully",
+		Data:    conversations,
+	})
+}
+
+// GetConversation godoc
+// @Summary Get a conversation
+// @Description Get a chat conversation of the current user with its messages
+// @Tags AI
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /chat/conversations/{id} [get]
+func GetConversation(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	conversation, err := services.GetConversation(userID, c.Param("id"))
+	if err != nil {
+		writeConversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Conversation retrieved successfully",
+		Data:    conversation,
+	})
+}
+
+// RenameConversation godoc
+// @Summary Rename a conversation
+// @Description Change the title of a chat conversation of the current user
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Conversation ID"
+// @Param title body RenameConversationBody true "Title"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /chat/conversations/{id} [put]
+func RenameConversation(c *gin.Context) {
+	var body RenameConversationBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+	if body.Title == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: "Title is required!",
+		})
+		return
+	}
+
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	conversation, err := services.RenameConversation(userID, c.Param("id"), body.Title)
+	if err != nil {
+		writeConversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Conversation renamed successfully",
+		Data:    conversation,
+	})
+}
+
+// DeleteConversation godoc
+// @Summary Delete a conversation
+// @Description Delete a chat conversation of the current user and its messages
+// @Tags AI
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /chat/conversations/{id} [delete]
+func DeleteConversation(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteConversation(userID, c.Param("id")); err != nil {
+		writeConversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Conversation deleted successfully",
+	})
+}
+
+func wantsStream(c *gin.Context) bool {
+	if stream, err := strconv.ParseBool(c.Query("stream")); err == nil {
+		return stream
+	}
+	return strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// streamChat relays the bot reply to the client as Server-Sent Events. Errors
+// raised before the first event are still returned as JSON.
+func streamChat(c *gin.Context, run func(onDelta func(delta string) error) (*models.ChatReply, error)) {
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+	}
+
+	chatResponse, err := run(func(delta string) error {
+		start()
+		c.SSEvent("message", gin.H{"delta": delta})
+		c.Writer.Flush()
+		return c.Request.Context().Err()
+	})
+	if err != nil {
+		if !started {
+			writeConversationError(c, err)
+			return
+		}
+		c.SSEvent("error", models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		c.Writer.Flush()
+		return
+	}
+
+	start()
+	c.SSEvent("done", chatResponse)
+	c.Writer.Flush()
+}
+
+// GetUsage godoc
+// @Summary Get AI token usage
+// @Description Get the token usage of the current user for the current day and month with the remaining quota
+// @Tags AI
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /chat/usage [get]
+func GetUsage(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	usage, err := services.GetUsageSummary(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Usage retrieved successfully",
+		Data:    usage,
+	})
+}
+
+func writeConversationError(c *gin.Context, err error) {
+	if quotaErr, ok := err.(*services.QuotaExceededError); ok {
+		retryAfter := int(time.Until(quotaErr.ResetAt()).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, models.Response{
+			Status:  "error",
+			Message: quotaErr.Error(),
+			Data:    quotaErr.Usage,
+		})
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch err {
+	case services.ErrInvalidCharacterID:
+		status = http.StatusBadRequest
+	case services.ErrConversationNotFound, repositories.ErrCharacterNotFound:
+		status = http.StatusNotFound
+	}
+	c.JSON(status, models.ErrorResponse{
+		Status:  "error",
+		Message: err.Error(),
 	})
 }
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"porty-go/models"
+	"porty-go/services"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeProvider streams its chunks, then fails with err when it is set
+type fakeProvider struct {
+	chunks []string
+	err    error
+}
+
+func (p *fakeProvider) Complete(ctx context.Context, messages []services.Message) (*services.ChatCompletion, error) {
+	return p.Stream(ctx, messages, func(string) error { return nil })
+}
+
+func (p *fakeProvider) Stream(ctx context.Context, messages []services.Message, onDelta func(delta string) error) (*services.ChatCompletion, error) {
+	for _, chunk := range p.chunks {
+		if err := onDelta(chunk); err != nil {
+			return nil, err
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &services.ChatCompletion{Content: strings.Join(p.chunks, ""), Model: "fake"}, nil
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// serveStream runs streamChat on the provider and returns the recorded response
+func serveStream(t *testing.T, provider services.LLMProvider) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/chat?stream=true", nil)
+
+	streamChat(c, func(onDelta func(delta string) error) (*models.ChatReply, error) {
+		completion, err := provider.Stream(c.Request.Context(), []services.Message{{Role: "user", Content: "Hi"}}, onDelta)
+		if err != nil {
+			return nil, err
+		}
+		return &models.ChatReply{ConversationID: "conversation", Message: completion.Content}, nil
+	})
+	return recorder
+}
+
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				event.name = name
+			}
+			if data, ok := strings.CutPrefix(line, "data:"); ok {
+				event.data = data
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestStreamChatSendsDeltasThenDone(t *testing.T) {
+	recorder := serveStream(t, &fakeProvider{chunks: []string{"Hel", "lo"}})
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", recorder.Code)
+	}
+	headers := map[string]string{
+		"Content-Type":      "text/event-stream",
+		"Cache-Control":     "no-cache",
+		"X-Accel-Buffering": "no",
+	}
+	for name, want := range headers {
+		if got := recorder.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	events := parseSSE(t, recorder.Body.String())
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %q", len(events), recorder.Body.String())
+	}
+	for i, want := range []string{"Hel", "lo"} {
+		var data struct {
+			Delta string `json:"delta"`
+		}
+		if events[i].name != "message" || json.Unmarshal([]byte(events[i].data), &data) != nil || data.Delta != want {
+			t.Errorf("event %d = %+v, want a message with delta %q", i, events[i], want)
+		}
+	}
+
+	var reply models.ChatReply
+	if events[2].name != "done" || json.Unmarshal([]byte(events[2].data), &reply) != nil {
+		t.Fatalf("last event = %+v, want done", events[2])
+	}
+	if reply.Message != "Hello" || reply.ConversationID != "conversation" {
+		t.Errorf("done reply = %+v", reply)
+	}
+}
+
+func TestStreamChatRelaysUpstreamSSE(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, frame := range []string{
+			`data: {"choices":[{"delta":{"content":"Hel"}}]}` + "\n\n",
+			`data: {"choices":[{"delta":{"content":"lo"}}]}` + "\n\n",
+			"data: [DONE]\n\n",
+		} {
+			_, _ = w.Write([]byte(frame))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	provider, err := services.NewLLMProvider(models.IntegrationService{ServiceUrl: upstream.URL, Provider: services.ProviderOpenAI}, upstream.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := serveStream(t, provider)
+
+	events := parseSSE(t, recorder.Body.String())
+	if len(events) != 3 || events[0].name != "message" || events[1].name != "message" || events[2].name != "done" {
+		t.Fatalf("events = %+v, want two messages then done", events)
+	}
+	var reply models.ChatReply
+	if err := json.Unmarshal([]byte(events[2].data), &reply); err != nil || reply.Message != "Hello" {
+		t.Errorf("done reply = %s, want Hello", events[2].data)
+	}
+}
+
+func TestStreamChatSendsErrorEventAfterStart(t *testing.T) {
+	recorder := serveStream(t, &fakeProvider{chunks: []string{"Hel"}, err: errors.New("upstream closed")})
+
+	if got := recorder.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+	events := parseSSE(t, recorder.Body.String())
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %q", len(events), recorder.Body.String())
+	}
+
+	var failure models.ErrorResponse
+	if events[1].name != "error" || json.Unmarshal([]byte(events[1].data), &failure) != nil {
+		t.Fatalf("last event = %+v, want error", events[1])
+	}
+	if failure.Status != "error" || failure.Message != "upstream closed" {
+		t.Errorf("error event = %+v", failure)
+	}
+}
+
+func TestStreamChatAnswersJSONBeforeStart(t *testing.T) {
+	recorder := serveStream(t, &fakeProvider{err: services.ErrConversationNotFound})
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", recorder.Code)
+	}
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		t.Errorf("Content-Type = %q, want JSON", got)
+	}
+}
+
+func TestWantsStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		target string
+		accept string
+		want   bool
+	}{
+		{"/chat?stream=true", "", true},
+		{"/chat?stream=false", "text/event-stream", false},
+		{"/chat", "text/event-stream", true},
+		{"/chat", "application/json", false},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, test.target, nil)
+		c.Request.Header.Set("Accept", test.accept)
+		if got := wantsStream(c); got != test.want {
+			t.Errorf("wantsStream(%s, Accept %q) = %v, want %v", test.target, test.accept, got, test.want)
+		}
+	}
+}
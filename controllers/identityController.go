@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"net/http"
+	"porty-go/models"
+	"porty-go/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListIdentities godoc
+// @Summary List linked identities
+// @Description List the login provider accounts linked to the current user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/identities [get]
+func ListIdentities(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	identities, err := services.ListIdentities(userID)
+	if err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Identities retrieved successfully",
+		Data:    identities,
+	})
+}
+
+// LinkIdentity godoc
+// @Summary Start linking a login provider
+// @Description Re-authenticate with the password, or a login from the last 5 minutes for accounts without one,
+// @Description and get the path of the provider login that links the provider account to the current user. The login
+// @Description redirects to redirectTo with a link_code to confirm through POST /auth/identities/confirm
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "Provider (google, github, discord, oidc)"
+// @Param body body models.LinkIdentityRequest true "Re-authentication"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/{provider}/link [post]
+func LinkIdentity(c *gin.Context) {
+	var body models.LinkIdentityRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	providerName := strings.ToLower(c.Param("provider"))
+	if _, _, ok := getOAuthProvider(c, providerName); !ok {
+		return
+	}
+
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return
+	}
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	url, err := services.StartIdentityLink(userID, userClaims.ID, providerName, body.Password, body.RedirectTo, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Open the url to continue linking",
+		Data:    models.LinkIdentityResponse{URL: url},
+	})
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink a login provider
+// @Description Remove the provider account from the current user. The last login method cannot be removed
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "Provider (google, github, discord, oidc)"
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/{provider}/link [delete]
+func UnlinkIdentity(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	if err := services.UnlinkIdentity(userID, strings.ToLower(c.Param("provider"))); err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Identity unlinked successfully",
+	})
+}
+
+// linkOAuthIdentity finishes an OAuth login started from LinkIdentity by
+// redirecting back to the frontend with a code, the user confirms the link
+// with it through ConfirmIdentityLink
+func linkOAuthIdentity(c *gin.Context, state services.OAuthState, identity services.OAuthIdentity) {
+	userID, err := primitive.ObjectIDFromHex(state.LinkUserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid state",
+		})
+		return
+	}
+
+	code, err := services.CreateLinkConfirmCode(userID, identity)
+	if err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusTemporaryRedirect, services.LinkRedirectURL(state.RedirectTo, code))
+}
+
+// ConfirmIdentityLink godoc
+// @Summary Confirm linking a login provider
+// @Description Link the provider account with the code the provider login redirected to the frontend with. Only the user
+// @Description who started the link can confirm it
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body models.ExchangeCodeRequest true "Link code"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/identities/confirm [post]
+func ConfirmIdentityLink(c *gin.Context) {
+	var body models.ExchangeCodeRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	provider, err := services.ConfirmIdentityLink(userID, body.Code)
+	if err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Identity linked successfully",
+		Data:    models.ConfirmLinkResponse{Provider: provider},
+	})
+}
+
+func writeIdentityError(c *gin.Context, err error) {
+	if writeLoginLimitError(c, err) {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch err {
+	case services.ErrInvalidRedirect:
+		status = http.StatusBadRequest
+	case services.ErrCurrentPasswordWrong, services.ErrReauthRequired, services.ErrInvalidLoginCode:
+		status = http.StatusUnauthorized
+	case services.ErrIdentityNotLinked:
+		status = http.StatusNotFound
+	case services.ErrIdentityInUse, services.ErrProviderAlreadyLinked, services.ErrLastLoginMethod:
+		status = http.StatusConflict
+	}
+	c.JSON(status, models.ErrorResponse{
+		Status:  "error",
+		Message: err.Error(),
+	})
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"porty-go/models"
+	"porty-go/services"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// linkConfirmCode is the stored code of a link started by the user
+func linkConfirmCode(userID primitive.ObjectID) bson.D {
+	return bson.D{
+		{Key: "ok", Value: 1},
+		{Key: "value", Value: bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "userId", Value: userID},
+			{Key: "purpose", Value: models.LoginCodePurposeLinkConfirm},
+			{Key: "identity", Value: bson.D{
+				{Key: "provider", Value: services.OAuthProviderOIDC},
+				{Key: "subject", Value: testOIDCSubject},
+			}},
+		}},
+	}
+}
+
+func confirmLink(userID primitive.ObjectID) *httptest.ResponseRecorder {
+	router := signedInRouter(userID, http.MethodPost, "/auth/identities/confirm", ConfirmIdentityLink)
+	req := httptest.NewRequest(http.MethodPost, "/auth/identities/confirm", strings.NewReader(`{"code":"link-code"}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestConfirmIdentityLinkRejectsAnotherUser(t *testing.T) {
+	mt := mockUsers(t)
+	mt.AddMockResponses(linkConfirmCode(primitive.NewObjectID()))
+
+	recorder := confirmLink(primitive.NewObjectID())
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401: %s", recorder.Code, recorder.Body.String())
+	}
+	for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+		if event.CommandName == "update" {
+			t.Errorf("the identity was linked: %s", event.Command)
+		}
+	}
+}
+
+func TestConfirmIdentityLinkRejectsIdentityLinkedToAnotherUser(t *testing.T) {
+	userID := primitive.NewObjectID()
+	mt := mockUsers(t)
+	mt.AddMockResponses(
+		linkConfirmCode(userID),
+		mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch, userDocument(primitive.NewObjectID())),
+	)
+
+	recorder := confirmLink(userID)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", recorder.Code, recorder.Body.String())
+	}
+	var failure models.ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &failure); err != nil || failure.Message != services.ErrIdentityInUse.Error() {
+		t.Errorf("body = %s, want %q", recorder.Body.String(), services.ErrIdentityInUse)
+	}
+}
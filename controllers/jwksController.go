@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"net/http"
+	"porty-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS godoc
+// @Summary Token verification keys
+// @Description Public keys of the access tokens as a JSON Web Key Set, selected by the kid header of a token. Keys are published before they start signing and removed once retired
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.JSONWebKeySet
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, services.JWKS())
+}
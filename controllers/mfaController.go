@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"net/http"
+	"porty-go/models"
+	"porty-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupMFA godoc
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret and its otpauth URI, to show as a QR code. Confirm it with /auth/mfa/enable
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/mfa/setup [post]
+func SetupMFA(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	setup, err := services.SetupMFA(userID)
+	if err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Scan the code with your authenticator app and confirm it",
+		Data:    setup,
+	})
+}
+
+// EnableMFA godoc
+// @Summary Enable two-factor authentication
+// @Description Confirm the enrollment with a code from the authenticator app. The recovery codes are only returned this time
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body models.MFACodeRequest true "Code"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/mfa/enable [post]
+func EnableMFA(c *gin.Context) {
+	var body models.MFACodeRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	codes, err := services.EnableMFA(userID, body.Code)
+	if err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Two-factor authentication enabled",
+		Data:    models.RecoveryCodesResponse{RecoveryCodes: codes},
+	})
+}
+
+// DisableMFA godoc
+// @Summary Disable two-factor authentication
+// @Description Re-authenticate with the password, or a login from the last 5 minutes for accounts without one, and give a code
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body models.MFADisableRequest true "Password and code"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/mfa/disable [post]
+func DisableMFA(c *gin.Context) {
+	var body models.MFADisableRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return
+	}
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	if err := services.DisableMFA(userID, userClaims.ID, body.Password, body.Code, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace the recovery codes after re-authenticating, with the password or a login from the last 5 minutes
+// @Description for accounts without one, and giving a code. The previous ones stop working
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body models.MFARecoveryCodesRequest true "Password and code"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/mfa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var body models.MFARecoveryCodesRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return
+	}
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(userID, userClaims.ID, body.Password, body.Code, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Recovery codes regenerated",
+		Data:    models.RecoveryCodesResponse{RecoveryCodes: codes},
+	})
+}
+
+// VerifyMFA godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the two-factor token returned by a login and a TOTP or recovery code for tokens
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param body body models.MFAVerifyRequest true "Token and code"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/mfa/verify [post]
+func VerifyMFA(c *gin.Context) {
+	var body models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	user, err := services.VerifyMFALogin(body.MFAToken, body.Code, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	writeSessionResponse(c, user, user.Password == "")
+}
+
+func writeMFAError(c *gin.Context, err error) {
+	if writeLoginLimitError(c, err) {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch err {
+	case services.ErrMFANotEnabled, services.ErrMFASetupRequired:
+		status = http.StatusBadRequest
+	case services.ErrInvalidMFACode, services.ErrInvalidMFAToken, services.ErrCurrentPasswordWrong, services.ErrReauthRequired:
+		status = http.StatusUnauthorized
+	case services.ErrMFAAlreadyEnabled:
+		status = http.StatusConflict
+	}
+	c.JSON(status, models.ErrorResponse{
+		Status:  "error",
+		Message: err.Error(),
+	})
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"porty-go/models"
+	"porty-go/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetMe godoc
+// @Summary Get the current user's profile
+// @Description Get the profile of the user the access token belongs to
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /me [get]
+func GetMe(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	user, err := services.GetProfile(userID)
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Profile retrieved successfully",
+		Data:    models.NewProfileResponse(user),
+	})
+}
+
+// UpdateMe godoc
+// @Summary Update the current user's profile
+// @Description Update the profile fields present in the body, an empty string clears a field. Give the version to fail with a conflict when the profile has been changed since
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body models.UpdateProfileRequest true "Profile fields"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /me [patch]
+func UpdateMe(c *gin.Context) {
+	var body models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	user, err := services.UpdateProfile(userID, body)
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Profile updated successfully",
+		Data:    models.NewProfileResponse(user),
+	})
+}
+
+// DeactivateMe godoc
+// @Summary Deactivate the current user's account
+// @Description Re-authenticate with the password, or a login from the last 5 minutes for accounts without one,
+// @Description and end every session. Logging in again reactivates the account
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body models.DeactivateAccountRequest true "Re-authentication"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /me/deactivate [post]
+func DeactivateMe(c *gin.Context) {
+	var body models.DeactivateAccountRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return
+	}
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	err := services.DeactivateAccount(userID, userClaims.ID, body.Password, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if writeLoginLimitError(c, err) {
+			return
+		}
+		switch err {
+		case services.ErrCurrentPasswordWrong, services.ErrReauthRequired:
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+		case services.ErrAccountDeactivated:
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+		default:
+			writeProfileError(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Status:  "success",
+		Message: "Account deactivated, log in again to reactivate it",
+	})
+}
+
+// ExportMe godoc
+// @Summary Export the current user's data
+// @Description Download the profile, conversations and auth events of the current user as JSON, or as a zip of JSON files with format=zip
+// @Tags me
+// @Produce json
+// @Produce application/zip
+// @Security BearerAuth
+// @Param format query string false "json (default) or zip"
+// @Success 200 {object} models.UserExport
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /me/export [get]
+func ExportMe(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: "format must be json or zip",
+		})
+		return
+	}
+
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	export, err := services.ExportUserData(userID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+
+	filename := "porty-export-" + export.ExportedAt.UTC().Format("20060102-150405")
+	c.Header("Cache-Control", "no-store")
+	if format == "zip" {
+		var buf bytes.Buffer
+		if err := services.WriteUserExportZip(&buf, export); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Status:  "error",
+				Message: "Failed to create the export",
+			})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		c.Data(http.StatusOK, "application/zip", buf.Bytes())
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+func writeProfileError(c *gin.Context, err error) {
+	if err == mongo.ErrNoDocuments {
+		err = services.ErrUserNotFound
+	}
+	writeUserUpdateError(c, err)
+}
@@ -1,21 +1,18 @@
 package controllers
 
 import (
-	"context"
+	"errors"
 	"net/http"
 	"os"
-	"porty-go/config"
 	"porty-go/models"
 	"porty-go/services"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/oauth2"
-	oauth2api "google.golang.org/api/oauth2/v2"
 )
 
 // CreateUser godoc
@@ -24,14 +21,14 @@ import (
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param user body models.User true "User"
+// @Param user body models.RegisterRequest true "User"
 // @Success 200 {object} models.Response
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /auth/register [post]
 func RegisterUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var request models.RegisterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
 			Message: err.Error(),
@@ -39,17 +36,13 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
-	if (user.Email == "") || (user.Password == "") {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Status:  "error",
-			Message: "Email and password are required!",
-		})
-		return
-	}
-
-	result, err := services.RegisterUser(user)
+	result, err := services.RegisterUser(request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		status := http.StatusInternalServerError
+		if err == services.ErrWeakPassword {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.ErrorResponse{
 			Status:  "error",
 			Message: err.Error(),
 		})
@@ -72,6 +65,10 @@ func RegisterUser(c *gin.Context) {
 // @Param login body models.LoginRequest true "Login"
 // @Success 200 {object} models.LoginResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /auth/login [post]
 func LoginUser(c *gin.Context) {
@@ -84,78 +81,118 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	user, err := services.GetUserByEmail(loginRequest.Email)
+	user, err := services.AuthenticateUser(loginRequest.Email, loginRequest.Password, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		if writeLoginLimitError(c, err) {
+			return
+		}
+
+		status := http.StatusInternalServerError
+		message := "Failed to login"
+		if err == services.ErrInvalidCredentials || err == services.ErrPasswordNotSet {
+			status = http.StatusUnauthorized
+			message = err.Error()
+		}
+		c.JSON(status, models.ErrorResponse{
 			Status:  "error",
-			Message: "Invalid email or password",
+			Message: message,
 		})
 		return
 	}
 
-	if user.Password == "" && user.IsGoogle {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+	if err := services.CheckLoginVerification(user); err != nil {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
 			Status:  "error",
-			Message: "You have registered with Google, please login with Google. Set password to login with email",
+			Message: err.Error(),
 		})
 		return
 	}
 
-	// Compare the hashed password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginRequest.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+	writeLoginResponse(c, user, false)
+}
+
+// OAuthLogin redirects the user to the login page of the provider. The
+// optional redirect_to query parameter must be on one of the allowed origins
+// and the link parameter carries the code from POST /auth/{provider}/link to
+// link the provider account instead of logging in.
+func OAuthLogin(c *gin.Context) {
+	providerName := strings.ToLower(c.Param("provider"))
+	_, oauthConfig, ok := getOAuthProvider(c, providerName)
+	if !ok {
+		return
+	}
+
+	redirectTo, err := services.ValidateRedirect(c.Query("redirect_to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
-			Message: "Invalid email or password",
+			Message: err.Error(),
 		})
 		return
 	}
 
-	// Generate a JWT token for the user
-	token, err := services.GenerateToken(user.ID.Hex(), user.Email, user.FullName)
+	verifier := oauth2.GenerateVerifier()
+	state, err := services.NewOAuthState(providerName, verifier, redirectTo)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
-			Message: "Failed to generate token",
+			Message: "Failed to create OAuth state",
 		})
 		return
 	}
 
-	result := models.DataLoginResponse{
-		IdUser:      user.ID.Hex(),
-		FullName:    user.FullName,
-		Email:       user.Email,
-		Token:       token,
-		SetPassword: false,
+	if linkCode := c.Query("link"); linkCode != "" {
+		userID, err := services.UseLinkCode(linkCode)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if err == services.ErrInvalidLoginCode {
+				status = http.StatusUnauthorized
+			}
+			c.JSON(status, models.ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+		state.LinkUserID = userID.Hex()
 	}
 
-	c.JSON(http.StatusOK, models.LoginResponse{
-		Status:  "success",
-		Message: "Login successful",
-		Data:    result,
-	})
-}
+	cookie, err := services.EncodeOAuthState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Message: "Failed to create OAuth state",
+		})
+		return
+	}
+	setOAuthStateCookie(c, cookie, int(services.OAuthStateTTL.Seconds()))
 
-// GoogleLogin redirects the user to the Google login page
-func GoogleLogin(c *gin.Context) {
-	url := config.GoogleOAuthConfig().AuthCodeURL("state", oauth2.AccessTypeOffline)
+	url := oauthConfig.AuthCodeURL(state.State, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
-// GoogleCallback handles the callback from Google after the user has logged in
-func GoogleCallback(c *gin.Context) {
-	_ = godotenv.Load()
-	service := os.Getenv("WEB_SERVICE")
-	// Set the Swagger host dynamically
-	service = strings.ToLower(service)
-	var frontendURL string
-	if service == "local" {
-		frontendURL = os.Getenv("FRONT_END_URL_LOCAL")
-	} else {
-		frontendURL = os.Getenv("FRONT_END_URL_SERVER")
+// OAuthCallback handles the callback from the provider after the user has
+// logged in
+func OAuthCallback(c *gin.Context) {
+	providerName := strings.ToLower(c.Param("provider"))
+	provider, oauthConfig, ok := getOAuthProvider(c, providerName)
+	if !ok {
+		return
 	}
 
-	state := c.Query("state")
-	if state != "state" {
+	cookie, err := c.Cookie(services.OAuthStateCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid state",
+		})
+		return
+	}
+	// The state can only be used once
+	setOAuthStateCookie(c, "", -1)
+
+	state, err := services.DecodeOAuthState(cookie, providerName, c.Query("state"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
 			Message: "Invalid state",
@@ -164,44 +201,218 @@ func GoogleCallback(c *gin.Context) {
 	}
 
 	code := c.Query("code")
-	redirectURLHome := frontendURL + "/"
-	token, err := config.GoogleOAuthConfig().Exchange(context.Background(), code)
+	redirectURLHome := services.GetFrontendURL() + "/"
+	token, err := oauthConfig.Exchange(c.Request.Context(), code, oauth2.VerifierOption(state.Verifier))
 	if err != nil {
 		c.Redirect(http.StatusTemporaryRedirect, redirectURLHome)
+		return
 	}
 
-	client := config.GoogleOAuthConfig().Client(context.Background(), token)
-	oauth2Service, err := oauth2api.New(client)
+	identity, err := provider.Identity(c.Request.Context(), oauthConfig, token)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
-			Message: "Failed to create OAuth2 service",
+			Message: "Failed to get user info",
 		})
 		return
 	}
 
-	userInfo, err := oauth2Service.Userinfo.Get().Do()
+	if state.LinkUserID != "" {
+		linkOAuthIdentity(c, state, identity)
+		return
+	}
+
+	// Find or create the user
+	user, err := services.CreateOrUpdateOAuth(identity)
 	if err != nil {
+		if err == services.ErrOAuthEmailRequired || err == services.ErrOAuthAccountExists {
+			status := http.StatusBadRequest
+			if err == services.ErrOAuthAccountExists {
+				status = http.StatusConflict
+			}
+			c.JSON(status, models.ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
-			Message: "Failed to get user info",
+			Message: "Failed to create or update user",
 		})
 		return
 	}
 
-	// Create or update the user
-	tokenString, err := services.CreateOrUpdateOAuth(userInfo)
+	loginCode, err := services.CreateLoginCode(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
-			Message: "Failed to create or update user",
+			Message: "Failed to create login code",
+		})
+		return
+	}
+
+	// Redirect to the frontend with a one-time code to exchange for tokens
+	c.Redirect(http.StatusTemporaryRedirect, services.LoginRedirectURL(state.RedirectTo, loginCode))
+}
+
+// ExchangeLoginCode godoc
+// @Summary Exchange a login code
+// @Description Exchange the one-time code received after an OAuth login for tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param code body models.ExchangeCodeRequest true "Login code"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/exchange [post]
+func ExchangeLoginCode(c *gin.Context) {
+	var body models.ExchangeCodeRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
 		})
 		return
 	}
-	// Redirect to the frontend with the token as a query parameter
-	redirectURLSucces := frontendURL + "/auth/success?token=" + tokenString
 
-	c.Redirect(http.StatusTemporaryRedirect, redirectURLSucces)
+	user, err := services.RedeemLoginCode(body.Code)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrInvalidLoginCode {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	writeLoginResponse(c, user, user.Password == "")
+}
+
+// writeLoginLimitError answers throttled logins with 429 and locked accounts
+// with 423, reporting whether err was one of them
+func writeLoginLimitError(c *gin.Context, err error) bool {
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		c.Header("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return true
+	}
+
+	var locked *services.AccountLockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(locked.Until).Seconds())+1))
+		c.JSON(http.StatusLocked, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return true
+	}
+	return false
+}
+
+// writeLoginResponse starts a session for the user, or answers with a
+// two-factor token when the user has a second factor to give first
+func writeLoginResponse(c *gin.Context, user models.User, setPassword bool) {
+	if user.MFAEnabled() {
+		mfaToken, err := services.GenerateMFAToken(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Status:  "error",
+				Message: "Failed to generate token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.LoginResponse{
+			Status:  "success",
+			Message: "Two-factor authentication required",
+			Data: models.DataLoginResponse{
+				IdUser:      user.ID.Hex(),
+				Email:       user.Email,
+				MFARequired: true,
+				MFAToken:    mfaToken,
+			},
+		})
+		return
+	}
+
+	writeSessionResponse(c, user, setPassword)
+}
+
+// writeSessionResponse starts a session for the user
+func writeSessionResponse(c *gin.Context, user models.User, setPassword bool) {
+	tokens, err := services.IssueSession(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		if err == services.ErrAccountDeleted {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Message: "Failed to generate token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LoginResponse{
+		Status:  "success",
+		Message: "Login successful",
+		Data: models.DataLoginResponse{
+			IdUser:       user.ID.Hex(),
+			FullName:     user.FullName,
+			Email:        user.Email,
+			Token:        tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
+			ExpiresIn:    tokens.ExpiresIn,
+			SetPassword:  setPassword,
+			Reactivated:  tokens.Reactivated,
+		},
+	})
+}
+
+// getOAuthProvider writes a 404 response when the provider is unknown or not
+// configured
+func getOAuthProvider(c *gin.Context, name string) (services.OAuthProvider, *oauth2.Config, bool) {
+	provider, err := services.GetOAuthProvider(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return nil, nil, false
+	}
+
+	oauthConfig, err := provider.Config(c.Request.Context())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrOAuthProviderDisabled {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return nil, nil, false
+	}
+	return provider, oauthConfig, true
+}
+
+func setOAuthStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.ToLower(os.Getenv("WEB_SERVICE")) != "local"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(services.OAuthStateCookie, value, maxAge, "/auth", "", secure, true)
 }
 
 // GetUser godoc
@@ -209,15 +420,23 @@ func GoogleCallback(c *gin.Context) {
 // @Description Get a user by ID
 // @Tags users
 // @Produce json
+// @Security BearerAuth
 // @Param id path string true "User ID"
 // @Success 200 {object} models.Response
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users/{id} [get]
 func GetUser(c *gin.Context) {
 	id := c.Param("id")
 	user, err := services.GetUser(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		status := http.StatusInternalServerError
+		if err == services.ErrUserNotFound {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{
 			Status:  "error",
 			Message: err.Error(),
 		})
@@ -226,70 +445,139 @@ func GetUser(c *gin.Context) {
 	c.JSON(http.StatusOK, models.Response{
 		Status:  "success",
 		Message: "User retrieved successfully",
-		Data:    user,
+		Data:    models.NewUserResponse(user),
 	})
 }
 
 // UpdateUser godoc
 // @Summary Update a user by ID
-// @Description Update a user by ID with the input payload
+// @Description Update the fields present in the body, the others are kept. Give the version of the user to fail
+// @Description with a conflict when it has been changed since. A new email has to be verified again
 // @Tags users
 // @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Param id path string true "User ID"
-// @Param user body models.User true "User"
+// @Param user body models.UpdateUserRequest true "Fields to update"
 // @Success 200 {object} models.Response
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
-// @Router /users/{id} [put]
+// @Router /users/{id} [patch]
 func UpdateUser(c *gin.Context) {
-	id := c.Param("id")
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var body models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
 			Message: err.Error(),
 		})
 		return
 	}
-	result, err := services.UpdateUserById(id, user)
+
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return
+	}
+
+	user, err := services.UpdateUser(c.Param("id"), body, userClaims.IsAdmin())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
+		writeUserUpdateError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, models.Response{
 		Status:  "success",
 		Message: "User updated successfully",
-		Data:    result,
+		Data:    models.NewUserResponse(user),
+	})
+}
+
+func writeUserUpdateError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case services.ErrEmptyProfileUpdate, services.ErrFullNameRequired, services.ErrInvalidAvatarURL,
+		services.ErrInvalidLocale, services.ErrInvalidTimezone, services.ErrPasswordChangeNotAllowed,
+		services.ErrEmailChangeNotPending:
+		status = http.StatusBadRequest
+	case services.ErrRoleChangeForbidden:
+		status = http.StatusForbidden
+	case services.ErrUserNotFound:
+		status = http.StatusNotFound
+	case services.ErrEmailTaken, services.ErrVersionConflict:
+		status = http.StatusConflict
+	}
+	c.JSON(status, models.ErrorResponse{
+		Status:  "error",
+		Message: err.Error(),
 	})
 }
 
 // DeleteUser godoc
 // @Summary Delete a user by ID
-// @Description Delete a user by ID
+// @Description Schedule the user for deletion and end their sessions. The data is purged after ACCOUNT_DELETION_GRACE,
+// @Description logging in before then restores accounts deleted by their owner. Users deleting their own account
+// @Description give their password, or need a recent login when they have none
 // @Tags users
+// @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Param id path string true "User ID"
+// @Param body body models.DeleteAccountRequest false "Re-authentication, for your own account"
 // @Success 200 {object} models.Response
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users/{id} [delete]
 func DeleteUser(c *gin.Context) {
+	userClaims, ok := getUserClaims(c)
+	if !ok {
+		return
+	}
+
 	id := c.Param("id")
-	result, err := services.DeleteUser(id)
+	var purgeAt time.Time
+	var err error
+	if id == userClaims.UserId {
+		var body models.DeleteAccountRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+		userID, ok := getUserObjectID(c)
+		if !ok {
+			return
+		}
+		purgeAt, err = services.DeleteOwnAccount(userID, userClaims.ID, body.Password, c.ClientIP(), c.Request.UserAgent())
+	} else {
+		purgeAt, err = services.DeleteAccount(id)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
+		if writeLoginLimitError(c, err) {
+			return
+		}
+		if err == services.ErrCurrentPasswordWrong || err == services.ErrReauthRequired {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+		writeUserUpdateError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, models.Response{
 		Status:  "success",
-		Message: "User deleted successfully",
-		Data:    result,
+		Message: "User scheduled for deletion",
+		Data:    models.AccountDeletionResponse{PurgeAt: purgeAt},
 	})
 }
 
@@ -306,27 +594,43 @@ func VerifyEmail(c *gin.Context) {
 	tokenString := c.Param("id")
 
 	// Parse the token
-	claims := &jwt.StandardClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
-
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
+	claims := &services.VerificationClaims{}
+	if err := services.ParseToken(tokenString, claims); err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Message: "Token has expired",
+			})
+		case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, services.ErrUnknownSigningKey):
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Status:  "error",
 				Message: "Invalid token",
 			})
+		default:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Message: "Bad request",
+			})
+		}
+		return
+	}
+
+	if claims.Purpose == services.TokenPurposeEmailChange {
+		user, err := services.ConfirmEmailChange(claims)
+		if err != nil {
+			writeUserUpdateError(c, err)
 			return
 		}
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Status:  "error",
-			Message: "Bad request",
+		c.JSON(http.StatusOK, models.Response{
+			Status:  "success",
+			Message: "Email changed successfully",
+			Data:    models.NewUserResponse(user),
 		})
 		return
 	}
 
-	if !token.Valid {
+	if claims.Purpose != services.TokenPurposeEmailVerification {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Status:  "error",
 			Message: "Invalid token",
@@ -350,22 +654,13 @@ func VerifyEmail(c *gin.Context) {
 		c.JSON(http.StatusOK, models.Response{
 			Status:  "success",
 			Message: "Email already verified",
-			Data:    user,
-		})
-		return
-	}
-
-	// Check if the token is expired
-	if claims.ExpiresAt < time.Now().Unix() {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Status:  "error",
-			Message: "Token has expired",
+			Data:    models.NewUserResponse(user),
 		})
 		return
 	}
 
 	// Verify the user
-	if _, err := services.VerifyUser(user.ID.Hex(), user); err != nil {
+	if _, err := services.VerifyUser(user.ID.Hex()); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
 			Message: err.Error(),
@@ -376,6 +671,6 @@ func VerifyEmail(c *gin.Context) {
 	c.JSON(http.StatusOK, models.Response{
 		Status:  "success",
 		Message: "Email verified successfully",
-		Data:    user,
+		Data:    models.NewUserResponse(user),
 	})
 }
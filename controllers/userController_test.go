@@ -0,0 +1,536 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"porty-go/models"
+	"porty-go/repositories"
+	"porty-go/services"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testFrontendURL  = "http://frontend.test"
+	testOIDCClientID = "porty-test"
+	testOIDCSubject  = "oidc-user-1"
+)
+
+// oidcStandIn is a local OpenID provider serving discovery, authorization,
+// token, userinfo and JWKS endpoints. Authorization codes are bound to their
+// PKCE challenge and the token endpoint rejects any other verifier.
+type oidcStandIn struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	emailVerified bool
+
+	mu         sync.Mutex
+	challenges map[string]string
+	exchanges  int
+	rejected   int
+}
+
+func newOIDCStandIn(t *testing.T) *oidcStandIn {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standIn := &oidcStandIn{key: key, emailVerified: true, challenges: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", standIn.discovery)
+	mux.HandleFunc("GET /authorize", standIn.authorize)
+	mux.HandleFunc("POST /token", standIn.token)
+	mux.HandleFunc("GET /userinfo", standIn.userinfo)
+	mux.HandleFunc("GET /jwks", standIn.jwks)
+	standIn.server = httptest.NewServer(mux)
+	t.Cleanup(standIn.server.Close)
+	return standIn
+}
+
+func (s *oidcStandIn) discovery(w http.ResponseWriter, r *http.Request) {
+	writeTestJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.server.URL,
+		"authorization_endpoint": s.server.URL + "/authorize",
+		"token_endpoint":         s.server.URL + "/token",
+		"userinfo_endpoint":      s.server.URL + "/userinfo",
+		"jwks_uri":               s.server.URL + "/jwks",
+	})
+}
+
+func (s *oidcStandIn) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != testOIDCClientID || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := oauth2.GenerateVerifier()
+	s.mu.Lock()
+	s.challenges[code] = query.Get("code_challenge")
+	s.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *oidcStandIn) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.exchanges++
+	challenge, ok := s.challenges[r.PostForm.Get("code")]
+	delete(s.challenges, r.PostForm.Get("code"))
+	verified := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verified[:]) != challenge {
+		s.rejected++
+		s.mu.Unlock()
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	s.mu.Unlock()
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    s.server.URL,
+		Subject:   testOIDCSubject,
+		Audience:  jwt.ClaimStrings{testOIDCClientID},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(s.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeTestJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-" + testOIDCSubject,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func (s *oidcStandIn) userinfo(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer access-"+testOIDCSubject {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	writeTestJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":            testOIDCSubject,
+		"email":          "player@example.com",
+		"email_verified": s.emailVerified,
+		"name":           "Player One",
+	})
+}
+
+func (s *oidcStandIn) jwks(w http.ResponseWriter, r *http.Request) {
+	writeTestJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// oauthFlow drives the login and callback handlers against the stand-in
+type oauthFlow struct {
+	t       *testing.T
+	standIn *oidcStandIn
+	router  *gin.Engine
+}
+
+func newOAuthFlow(t *testing.T, standIn *oidcStandIn) *oauthFlow {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("WEB_SERVICE", "local")
+	t.Setenv("FRONT_END_URL_LOCAL", testFrontendURL)
+	t.Setenv("OAUTH_STATE_SECRET", "test-oauth-state-secret")
+	t.Setenv("OIDC_ISSUER_URL", standIn.server.URL)
+	t.Setenv("OIDC_CLIENT_ID", testOIDCClientID)
+	t.Setenv("OIDC_CLIENT_SECRET", "test-secret")
+	t.Setenv("OIDC_REDIRECT_URL", "http://porty.test/auth/oidc/callback")
+
+	router := gin.New()
+	router.GET("/auth/:provider/login", OAuthLogin)
+	router.GET("/auth/:provider/callback", OAuthCallback)
+	return &oauthFlow{t: t, standIn: standIn, router: router}
+}
+
+// authorize starts the login and lets the stand-in authorize it, returning
+// the state cookie and the callback query the provider redirected to
+func (f *oauthFlow) authorize(loginQuery string) (string, url.Values) {
+	f.t.Helper()
+	login := httptest.NewRecorder()
+	f.router.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?"+loginQuery, nil))
+	if login.Code != http.StatusTemporaryRedirect {
+		f.t.Fatalf("login status = %d: %s", login.Code, login.Body.String())
+	}
+
+	var cookie string
+	for _, c := range login.Result().Cookies() {
+		if c.Name == services.OAuthStateCookie {
+			cookie = c.Value
+		}
+	}
+	if cookie == "" {
+		f.t.Fatal("login did not set the state cookie")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(login.Header().Get("Location"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		f.t.Fatalf("authorize status = %d", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return cookie, callback.Query()
+}
+
+func (f *oauthFlow) callback(cookie string, query url.Values) *httptest.ResponseRecorder {
+	f.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+query.Encode(), nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: services.OAuthStateCookie, Value: cookie})
+	}
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// mockUsers points the repositories at a mock deployment, which answers
+// with the responses added to the returned T
+func mockUsers(t *testing.T) *mtest.T {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ShareClient(true))
+
+	// Index creation fails against the mock, which is only logged
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	repositories.Init(mt.Client)
+	log.SetOutput(output)
+	mt.ClearEvents()
+	return mt
+}
+
+func userDocument(id primitive.ObjectID) bson.D {
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "email", Value: "player@example.com"},
+		{Key: "identities", Value: bson.A{bson.D{{Key: "provider", Value: services.OAuthProviderOIDC}, {Key: "subject", Value: testOIDCSubject}}}},
+	}
+}
+
+func TestOAuthCallbackLogsInWithOIDC(t *testing.T) {
+	flow := newOAuthFlow(t, newOIDCStandIn(t))
+	mt := mockUsers(t)
+	mt.AddMockResponses(
+		mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch, userDocument(primitive.NewObjectID())),
+		bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		mtest.CreateSuccessResponse(),
+	)
+
+	recorder := flow.callback(flow.authorize(""))
+	if recorder.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body.String())
+	}
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), testFrontendURL+"/auth/success?") || location.Query().Get("code") == "" {
+		t.Errorf("redirect = %q, want the frontend with a login code", recorder.Header().Get("Location"))
+	}
+}
+
+func TestOAuthCallbackRejectsInvalidState(t *testing.T) {
+	standIn := newOIDCStandIn(t)
+	flow := newOAuthFlow(t, standIn)
+	cookie, query := flow.authorize("")
+
+	wrongState := url.Values{"code": {query.Get("code")}, "state": {"not-the-state"}}
+	encoded, signature, _ := strings.Cut(cookie, ".")
+	tampered := encoded + "." + strings.Repeat("A", len(signature))
+
+	tests := []struct {
+		name   string
+		cookie string
+		query  url.Values
+	}{
+		{"missing cookie", "", query},
+		{"state mismatch", cookie, wrongState},
+		{"missing state", cookie, url.Values{"code": {query.Get("code")}}},
+		{"tampered cookie", tampered, query},
+	}
+	for _, test := range tests {
+		recorder := flow.callback(test.cookie, test.query)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", test.name, recorder.Code)
+		}
+	}
+	if standIn.exchanges != 0 {
+		t.Errorf("the code was exchanged %d times with an invalid state", standIn.exchanges)
+	}
+}
+
+func TestOAuthCallbackRejectsPKCEMismatch(t *testing.T) {
+	standIn := newOIDCStandIn(t)
+	flow := newOAuthFlow(t, standIn)
+	cookie, query := flow.authorize("")
+
+	// Re-sign the state with a verifier the challenge was not made from
+	state, err := services.DecodeOAuthState(cookie, services.OAuthProviderOIDC, query.Get("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Verifier = "a-different-verifier-than-the-one-sent-with-the-challenge"
+	forged, err := services.EncodeOAuthState(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := flow.callback(forged, query)
+	if recorder.Code != http.StatusTemporaryRedirect || recorder.Header().Get("Location") != testFrontendURL+"/" {
+		t.Errorf("status = %d, location = %q, want the frontend home", recorder.Code, recorder.Header().Get("Location"))
+	}
+	// The client retries a rejected exchange with the other auth style
+	if standIn.exchanges == 0 || standIn.rejected != standIn.exchanges {
+		t.Errorf("stand-in accepted %d of %d exchanges, want none", standIn.exchanges-standIn.rejected, standIn.exchanges)
+	}
+}
+
+func TestOAuthCallbackRejectsUnverifiedEmail(t *testing.T) {
+	standIn := newOIDCStandIn(t)
+	standIn.emailVerified = false
+	flow := newOAuthFlow(t, standIn)
+	mt := mockUsers(t)
+	mt.AddMockResponses(mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch))
+
+	recorder := flow.callback(flow.authorize(""))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", recorder.Code, recorder.Body.String())
+	}
+	var failure models.ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &failure); err != nil || failure.Message != services.ErrOAuthEmailRequired.Error() {
+		t.Errorf("body = %s, want %q", recorder.Body.String(), services.ErrOAuthEmailRequired)
+	}
+}
+
+func TestOAuthCallbackHoldsLinkUntilConfirmed(t *testing.T) {
+	flow := newOAuthFlow(t, newOIDCStandIn(t))
+	mt := mockUsers(t)
+	linkCode := bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "userId", Value: primitive.NewObjectID()},
+		{Key: "purpose", Value: models.LoginCodePurposeLink},
+	}
+	mt.AddMockResponses(
+		bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: linkCode}},
+		mtest.CreateSuccessResponse(),
+	)
+
+	recorder := flow.callback(flow.authorize("link=link-code"))
+	if recorder.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body.String())
+	}
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil || location.Query().Get("link_code") == "" {
+		t.Errorf("redirect = %q, want the frontend with a link code", recorder.Header().Get("Location"))
+	}
+
+	var insert bson.Raw
+	for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+		if event.CommandName == "update" {
+			t.Errorf("the user was updated before confirming: %s", event.Command)
+		}
+		if event.CommandName == "insert" {
+			insert = event.Command
+		}
+	}
+	if subject, err := insert.LookupErr("documents", "0", "identity", "subject"); err != nil || subject.StringValue() != testOIDCSubject {
+		t.Errorf("stored link code = %s, want the provider account", insert)
+	}
+}
+
+func TestLoginThrottlesPasswordSprayBehindSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	services.SetAttemptStore(services.NewMemoryAttemptStore())
+	router := gin.New()
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	router.POST("/auth/login", LoginUser)
+
+	login := func(i int) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"email":"user%d@example.com","password":"Password1!"}`, i)
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		req.RemoteAddr = "203.0.113.7:5000"
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	mt := mockUsers(t)
+	for i := 0; ; i++ {
+		// Each failure looks the email up and records an auth event
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch), mtest.CreateSuccessResponse())
+		recorder := login(i)
+		if recorder.Code == http.StatusTooManyRequests {
+			if i != 30 {
+				t.Fatalf("throttled after %d failures, want 30 from one IP", i)
+			}
+			return
+		}
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("login %d status = %d: %s", i, recorder.Code, recorder.Body.String())
+		}
+		if i == 30 {
+			t.Fatal("a different email and X-Forwarded-For on every login is never throttled")
+		}
+	}
+}
+
+// signedInRouter serves the handler as the user, as JWTAuth would have
+func signedInRouter(userID primitive.ObjectID, method, path string, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, path, func(c *gin.Context) {
+		c.Set("user", &services.CustomClaims{
+			UserId:           userID.Hex(),
+			Role:             models.RoleUser,
+			RegisteredClaims: jwt.RegisteredClaims{ID: primitive.NewObjectID().Hex()},
+		})
+	}, handler)
+	return router
+}
+
+func TestDeleteOwnAccountRequiresPassword(t *testing.T) {
+	services.SetAttemptStore(services.NewMemoryAttemptStore())
+	hash, err := bcrypt.GenerateFromPassword([]byte("Password1!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := primitive.NewObjectID()
+	router := signedInRouter(id, http.MethodDelete, "/users/:id", DeleteUser)
+	mt := mockUsers(t)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no body", "", http.StatusBadRequest},
+		{"wrong password", `{"password":"wrong"}`, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		// The user lookup, then the failed login event
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: id},
+				{Key: "email", Value: "player@example.com"},
+				{Key: "password", Value: string(hash)},
+			}),
+			mtest.CreateSuccessResponse(),
+		)
+		mt.ClearEvents()
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/users/"+id.Hex(), strings.NewReader(test.body)))
+		if recorder.Code != test.want {
+			t.Errorf("%s: status = %d, want %d: %s", test.name, recorder.Code, test.want, recorder.Body.String())
+		}
+		for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+			if event.CommandName == "update" {
+				t.Errorf("%s: the account was updated: %s", test.name, event.Command)
+			}
+		}
+		mt.ClearMockResponses()
+	}
+}
+
+func TestRegisterUserRejectsShortPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/register", RegisterUser)
+	mt := mockUsers(t)
+
+	body := `{"fullName":"Player One","email":"player@example.com","password":"short"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400: %s", recorder.Code, recorder.Body.String())
+	}
+	if event := mt.GetStartedEvent(); event != nil {
+		t.Errorf("the database was queried: %s", event.Command)
+	}
+}
+
+func TestGetUserAnswersNotFound(t *testing.T) {
+	router := signedInRouter(primitive.NewObjectID(), http.MethodGet, "/users/:id", GetUser)
+	mt := mockUsers(t)
+
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"malformed id", "not-an-id"},
+		{"unknown id", primitive.NewObjectID().Hex()},
+	}
+	for _, test := range tests {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch))
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users/"+test.id, nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404: %s", test.name, recorder.Code, recorder.Body.String())
+		}
+		mt.ClearMockResponses()
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"porty-go/models"
+	"porty-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets through users having one of the given roles. It must
+// be registered after JWTAuth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			return
+		}
+
+		for _, role := range roles {
+			if claims.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		forbidden(c)
+	}
+}
+
+// RequireSelfOrAdmin only lets through users acting on their own ID, taken
+// from the given path parameter, and admins. It must be registered after
+// JWTAuth.
+func RequireSelfOrAdmin(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			return
+		}
+
+		if claims.IsAdmin() || claims.UserId == c.Param(param) {
+			c.Next()
+			return
+		}
+
+		forbidden(c)
+	}
+}
+
+func currentClaims(c *gin.Context) (*services.CustomClaims, bool) {
+	userData, exists := c.Get("user")
+	claims, ok := userData.(*services.CustomClaims)
+	if !exists || !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Status:  "error",
+			Message: "Authentication is required",
+		})
+		c.Abort()
+		return nil, false
+	}
+	return claims, true
+}
+
+func forbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, models.ErrorResponse{
+		Status:  "error",
+		Message: "You are not allowed to access this resource",
+	})
+	c.Abort()
+}
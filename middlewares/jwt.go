@@ -1,16 +1,14 @@
 package middleware
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
-	"os"
 	"porty-go/models"
 	"porty-go/services"
 	"strings"
-	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func JWTAuth() gin.HandlerFunc {
@@ -35,15 +33,16 @@ func JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		secretKey := os.Getenv("JWT_SECRET")
-		token, err := jwt.ParseWithClaims(tokenString, &services.CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		claims := &services.CustomClaims{}
+		if err := services.ParseToken(tokenString, claims); err != nil {
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+					Status:  "error",
+					Message: "Token has expired",
+				})
+				c.Abort()
+				return
 			}
-			return []byte(secretKey), nil
-		})
-
-		if err != nil || !token.Valid {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Status:  "error",
 				Message: err.Error(),
@@ -52,23 +51,29 @@ func JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		// Extract claims
-		claims, ok := token.Claims.(*services.CustomClaims)
-		fmt.Println("claims", claims.Email)
-		if !ok {
+		// Only access tokens can authenticate requests
+		if claims.Purpose != services.TokenPurposeAccess {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Status:  "error",
-				Message: "Failed to parse token claims",
+				Message: "Invalid token",
 			})
 			c.Abort()
 			return
 		}
 
-		currentTimestamp := time.Now().Unix()
-		if claims.ExpiresAt < currentTimestamp {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  "error",
-				"message": "Token has expired",
+		revoked, err := services.IsTokenRevoked(claims.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Status:  "error",
+				Message: "Failed to check token revocation",
+			})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Message: "Token has been revoked",
 			})
 			c.Abort()
 			return
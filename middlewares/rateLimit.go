@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"porty-go/models"
+	"porty-go/services"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitSweepInterval is how often idle buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitConfig describes a token bucket: clients can make Burst requests
+// at once and get Rate requests back every Period
+type RateLimitConfig struct {
+	Burst  int
+	Rate   int
+	Period time.Duration
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimiter struct {
+	config    RateLimitConfig
+	perSecond float64
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// RateLimit limits the requests of each user, or client IP for anonymous
+// requests, with a token bucket kept in memory. Users are only recognized
+// when registered after JWTAuth. Every response carries the RateLimit-*
+// headers and exhausted clients get a 429.
+func RateLimit(config RateLimitConfig) gin.HandlerFunc {
+	if config.Burst <= 0 || config.Rate <= 0 || config.Period <= 0 {
+		panic("rate limit burst, rate and period must be positive")
+	}
+
+	limiter := &rateLimiter{
+		config:    config,
+		perSecond: float64(config.Rate) / config.Period.Seconds(),
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+
+	return func(c *gin.Context) {
+		allowed, remaining, reset, retryAfter := limiter.take(rateLimitKey(c), time.Now())
+
+		c.Header("RateLimit-Limit", strconv.Itoa(config.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", config.Rate, ceilSeconds(config.Period)))
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Status:  "error",
+				Message: fmt.Sprintf("Too many requests, try again in %d seconds", ceilSeconds(retryAfter)),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// take spends a token of the key's bucket if there is one. It returns the
+// tokens left, the time until the bucket is full again and, when refused, the
+// time until the next token.
+func (l *rateLimiter) take(key string, now time.Time) (bool, int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	burst := float64(l.config.Burst)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.perSecond)
+	bucket.updated = now
+
+	allowed := bucket.tokens >= 1
+	var retryAfter time.Duration
+	if allowed {
+		bucket.tokens--
+	} else {
+		retryAfter = l.refillTime(1 - bucket.tokens)
+	}
+
+	return allowed, int(bucket.tokens), l.refillTime(burst - bucket.tokens), retryAfter
+}
+
+// sweep drops the buckets that would be full by now, they are the same as a
+// new bucket
+func (l *rateLimiter) sweep(now time.Time) {
+	burst := float64(l.config.Burst)
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.perSecond >= burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *rateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / l.perSecond * float64(time.Second))
+}
+
+// rateLimitKey identifies the client by user ID when JWTAuth has run before,
+// by IP otherwise
+func rateLimitKey(c *gin.Context) string {
+	if userData, exists := c.Get("user"); exists {
+		if claims, ok := userData.(*services.CustomClaims); ok && claims.UserId != "" {
+			return "user:" + claims.UserId
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
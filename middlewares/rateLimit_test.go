@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitedRouter allows one request per hour to each client behind the proxies
+func limitedRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(RateLimit(RateLimitConfig{Burst: 1, Rate: 1, Period: time.Hour}))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func requestFrom(r *gin.Engine, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	r := limitedRouter(t, nil)
+
+	if code := requestFrom(r, "203.0.113.7:5000", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", code)
+	}
+	if code := requestFrom(r, "203.0.113.7:5000", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("status with a new X-Forwarded-For = %d, want 429", code)
+	}
+}
+
+func TestRateLimitUsesForwardedForFromTrustedProxy(t *testing.T) {
+	r := limitedRouter(t, []string{"10.0.0.0/8"})
+
+	if code := requestFrom(r, "10.0.0.2:5000", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first client status = %d, want 200", code)
+	}
+	if code := requestFrom(r, "10.0.0.2:5000", "198.51.100.2"); code != http.StatusOK {
+		t.Errorf("second client status = %d, want 200", code)
+	}
+	if code := requestFrom(r, "10.0.0.3:5000", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("first client through another proxy status = %d, want 429", code)
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// DeactivateAccountRequest re-authenticates the user, accounts without a
+// password need a recent login instead
+type DeactivateAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// DeleteAccountRequest re-authenticates a user deleting their own account,
+// accounts without a password need a recent login instead
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// AccountDeletionResponse tells when a deleted account will be purged
+type AccountDeletionResponse struct {
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// UserExport is the personal data kept about a user, returned by
+// GET /me/export
+type UserExport struct {
+	ExportedAt    time.Time            `json:"exportedAt"`
+	Profile       ProfileResponse      `json:"profile"`
+	LastLogin     *time.Time           `json:"lastLogin"`
+	VerifyAt      *time.Time           `json:"verifyAt"`
+	Conversations []ConversationDetail `json:"conversations"`
+	AuthEvents    []AuthEvent          `json:"authEvents"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuthEventLoginSuccess   = "login_success"
+	AuthEventLoginFailure   = "login_failure"
+	AuthEventLoginThrottled = "login_throttled"
+	AuthEventAccountLocked  = "account_locked"
+
+	AuthEventAccountDeactivated = "account_deactivated"
+	AuthEventAccountDeleted     = "account_deleted"
+	AuthEventAccountReactivated = "account_reactivated"
+	AuthEventDataExported       = "data_exported"
+)
+
+// AuthEvent is a login attempt or account change kept for auditing. UserID is nil when the
+// email does not belong to an account.
+type AuthEvent struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Type      string              `bson:"type" json:"type"`
+	UserID    *primitive.ObjectID `bson:"userId,omitempty" json:"userId,omitempty"`
+	Email     string              `bson:"email" json:"email"`
+	IP        string              `bson:"ip" json:"ip"`
+	UserAgent string              `bson:"userAgent" json:"userAgent"`
+	Reason    string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+}
+
+// LoginAttempts counts the failed logins of an IP or email within a window
+// ending at ExpiresAt
+type LoginAttempts struct {
+	Key       string    `bson:"_id"`
+	Count     int       `bson:"count"`
+	LastAt    time.Time `bson:"lastAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
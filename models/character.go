@@ -1,16 +1,110 @@
 package models
 
+// Character values accepted by the admin endpoints
+var (
+	CharacterElements    = []string{"Pyro", "Hydro", "Anemo", "Electro", "Dendro", "Cryo", "Geo"}
+	CharacterWeaponTypes = []string{"Sword", "Claymore", "Polearm", "Bow", "Catalyst"}
+	CharacterRarities    = []string{"4", "5"}
+)
+
+// Character is a row of the Supabase characters table. The binding tags
+// validate the characters written by admins, keep them in sync with the
+// lists above. ID and PublicID are ignored on writes, responses carry the
+// PublicID alone.
 type Character struct {
 	ID          *int    `json:"id,omitempty"`
-	EncryptedID *string `json:"encrypted_id,omitempty"`
-	Name        string  `json:"name"`
-	Element     string  `json:"element"`
-	WeaponType  string  `json:"weapon_type"`
-	Rarity      string  `json:"rarity"`
-	Role        *string `json:"role"`
-	Description *string `json:"description"`
-	ReleaseDate string  `json:"release_date"`
-	BaseAttack  int     `json:"base_attack"`
-	BaseDefense int     `json:"base_defense"`
-	BaseHealth  int     `json:"base_health"`
+	PublicID    *string `json:"public_id,omitempty"`
+	Name        string  `json:"name" binding:"required,max=100"`
+	Element     string  `json:"element" binding:"required,oneof=Pyro Hydro Anemo Electro Dendro Cryo Geo"`
+	WeaponType  string  `json:"weapon_type" binding:"required,oneof=Sword Claymore Polearm Bow Catalyst"`
+	Rarity      string  `json:"rarity" binding:"required,oneof=4 5"`
+	Role        *string `json:"role" binding:"omitempty,max=50"`
+	Description *string `json:"description" binding:"omitempty,max=2000"`
+	ReleaseDate string  `json:"release_date" binding:"required,datetime=2006-01-02"`
+	BaseAttack  int     `json:"base_attack" binding:"min=0"`
+	BaseDefense int     `json:"base_defense" binding:"min=0"`
+	BaseHealth  int     `json:"base_health" binding:"min=0"`
+}
+
+// CharacterPatch changes the fields of a character that are present
+type CharacterPatch struct {
+	Name        *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Element     *string `json:"element,omitempty" binding:"omitempty,oneof=Pyro Hydro Anemo Electro Dendro Cryo Geo"`
+	WeaponType  *string `json:"weapon_type,omitempty" binding:"omitempty,oneof=Sword Claymore Polearm Bow Catalyst"`
+	Rarity      *string `json:"rarity,omitempty" binding:"omitempty,oneof=4 5"`
+	Role        *string `json:"role,omitempty" binding:"omitempty,max=50"`
+	Description *string `json:"description,omitempty" binding:"omitempty,max=2000"`
+	ReleaseDate *string `json:"release_date,omitempty" binding:"omitempty,datetime=2006-01-02"`
+	BaseAttack  *int    `json:"base_attack,omitempty" binding:"omitempty,min=0"`
+	BaseDefense *int    `json:"base_defense,omitempty" binding:"omitempty,min=0"`
+	BaseHealth  *int    `json:"base_health,omitempty" binding:"omitempty,min=0"`
+}
+
+// IsEmpty reports whether the patch changes nothing
+func (p CharacterPatch) IsEmpty() bool {
+	return p.Name == nil && p.Element == nil && p.WeaponType == nil && p.Rarity == nil && p.Role == nil &&
+		p.Description == nil && p.ReleaseDate == nil && p.BaseAttack == nil && p.BaseDefense == nil && p.BaseHealth == nil
+}
+
+// CharacterListQuery filters, sorts and pages GET /characters. List filters
+// take repeated or comma-separated values, Sort is a comma-separated list of
+// fields, descending when prefixed with "-". Record is the former name of
+// PageSize.
+type CharacterListQuery struct {
+	Page         int      `form:"page,default=1" binding:"min=1"`
+	PageSize     int      `form:"page_size" binding:"omitempty,min=1,max=100"`
+	Record       int      `form:"record" binding:"omitempty,min=1,max=100"`
+	Search       string   `form:"search" binding:"max=100"`
+	Element      []string `form:"element"`
+	WeaponType   []string `form:"weapon_type"`
+	Rarity       []string `form:"rarity"`
+	Role         []string `form:"role"`
+	ReleasedFrom string   `form:"released_from" binding:"omitempty,datetime=2006-01-02"`
+	ReleasedTo   string   `form:"released_to" binding:"omitempty,datetime=2006-01-02"`
+	MinAttack    *int     `form:"min_attack" binding:"omitempty,min=0"`
+	MaxAttack    *int     `form:"max_attack" binding:"omitempty,min=0"`
+	MinDefense   *int     `form:"min_defense" binding:"omitempty,min=0"`
+	MaxDefense   *int     `form:"max_defense" binding:"omitempty,min=0"`
+	MinHealth    *int     `form:"min_health" binding:"omitempty,min=0"`
+	MaxHealth    *int     `form:"max_health" binding:"omitempty,min=0"`
+	Sort         string   `form:"sort" binding:"max=200"`
+}
+
+// CharacterSort orders the list by a column
+type CharacterSort struct {
+	Column     string
+	Descending bool
+}
+
+// CharacterFilter is a validated CharacterListQuery
+type CharacterFilter struct {
+	Offset       int
+	Limit        int
+	Search       string
+	Elements     []string
+	WeaponTypes  []string
+	Rarities     []string
+	Roles        []string
+	ReleasedFrom string
+	ReleasedTo   string
+	StatRanges   []CharacterStatRange
+	Sort         []CharacterSort
+}
+
+// CharacterStatRange bounds a base stat column, nil bounds are open
+type CharacterStatRange struct {
+	Column string
+	Min    *int
+	Max    *int
+}
+
+// CharacterPage is a page of characters with links to the pages around it
+type CharacterPage struct {
+	Items      []Character `json:"items"`
+	Total      int64       `json:"total"`
+	Page       int         `json:"page"`
+	PageSize   int         `json:"pageSize"`
+	TotalPages int         `json:"totalPages"`
+	Next       *string     `json:"next"`
+	Prev       *string     `json:"prev"`
 }
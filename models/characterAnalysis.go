@@ -0,0 +1,61 @@
+package models
+
+// CompareCharactersRequest lists the public IDs of the characters to compare,
+// the first one is the baseline of the deltas
+type CompareCharactersRequest struct {
+	IDs []string `json:"ids" binding:"required,min=2,max=10,dive,required"`
+}
+
+// AnalyzeTeamRequest lists the public IDs of the party members
+type AnalyzeTeamRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=4,dive,required"`
+}
+
+// CharacterStats are the base stats of a character, or a difference or sum
+// of them
+type CharacterStats struct {
+	Attack  int `json:"attack"`
+	Defense int `json:"defense"`
+	Health  int `json:"health"`
+}
+
+// CharacterAverageStats are the base stats averaged over a team
+type CharacterAverageStats struct {
+	Attack  float64 `json:"attack"`
+	Defense float64 `json:"defense"`
+	Health  float64 `json:"health"`
+}
+
+// CharacterComparisonEntry is a character with its stats and their
+// difference from the baseline
+type CharacterComparisonEntry struct {
+	Character Character      `json:"character"`
+	Stats     CharacterStats `json:"stats"`
+	Delta     CharacterStats `json:"delta"`
+}
+
+// CharacterStatLeaders are the public IDs of the characters with the highest
+// of each stat, the first one compared wins ties
+type CharacterStatLeaders struct {
+	Attack  string `json:"attack"`
+	Defense string `json:"defense"`
+	Health  string `json:"health"`
+}
+
+type CharacterComparison struct {
+	Baseline   string                     `json:"baseline"`
+	Characters []CharacterComparisonEntry `json:"characters"`
+	Highest    CharacterStatLeaders       `json:"highest"`
+}
+
+// TeamAnalysis describes a party: the elements and roles it covers and its
+// base stats. Members without a role are counted in UnassignedRoles.
+type TeamAnalysis struct {
+	Characters      []Character           `json:"characters"`
+	Elements        map[string]int        `json:"elements"`
+	MissingElements []string              `json:"missingElements"`
+	Roles           map[string]int        `json:"roles"`
+	UnassignedRoles int                   `json:"unassignedRoles"`
+	TotalStats      CharacterStats        `json:"totalStats"`
+	AverageStats    CharacterAverageStats `json:"averageStats"`
+}
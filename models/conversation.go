@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Conversation groups the chat messages of a user. CharacterID is only set for
+// roleplay conversations with a character.
+type Conversation struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	Title       string             `bson:"title" json:"title"`
+	CharacterID *int               `bson:"characterId,omitempty" json:"-"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   *time.Time         `bson:"updatedAt" json:"updatedAt"`
+}
+
+type ConversationMessage struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ConversationID primitive.ObjectID `bson:"conversationId" json:"conversationId"`
+	UserID         primitive.ObjectID `bson:"userId" json:"userId"`
+	Role           string             `bson:"role" json:"role"`
+	Content        string             `bson:"content" json:"content"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type ConversationDetail struct {
+	Conversation
+	Messages []ConversationMessage `json:"messages"`
+}
+
+type ChatReply struct {
+	ConversationID string `json:"conversationId"`
+	Message        string `json:"message"`
+}
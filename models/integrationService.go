@@ -2,6 +2,9 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// IntegrationService stores the endpoint and credentials of an external
+// service. For chat services, Provider selects the API shape (openai,
+// anthropic or ollama) and falls back to ServiceName when empty.
 type IntegrationService struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" swaggerignore:"true"`
 	ServiceName string             `json:"serviceName,omitempty"`
@@ -10,4 +13,6 @@ type IntegrationService struct {
 	UserName    string             `json:"userName"`
 	Password    string             `json:"password"`
 	Model       string             `json:"model"`
+	Provider    string             `json:"provider,omitempty"`
+	MaxTokens   int                `json:"maxTokens,omitempty"`
 }
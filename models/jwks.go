@@ -0,0 +1,19 @@
+package models
+
+// JSONWebKey is the public part of a token signing key (RFC 7517). RSA keys
+// carry N and E, Ed25519 keys Crv and X.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet lists the keys other services verify porty tokens with
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
@@ -1,16 +1,29 @@
 package models
 
+// RegisterRequest is the body of /auth/register. Every other field of the
+// account is set by the server.
+type RegisterRequest struct {
+	FullName string `json:"fullName" binding:"max=100"`
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
 type DataLoginResponse struct {
-	IdUser      string `bson:"idUser" json:"idUser"`
-	FullName    string `bson:"fullName" json:"fullName"`
-	Email       string `bson:"email" json:"email"`
-	SetPassword bool   `bson:"setPassword" json:"setPassword"`
-	Token       string `bson:"token" json:"token"`
+	IdUser       string `bson:"idUser" json:"idUser"`
+	FullName     string `bson:"fullName" json:"fullName"`
+	Email        string `bson:"email" json:"email"`
+	SetPassword  bool   `bson:"setPassword" json:"setPassword"`
+	Token        string `bson:"token" json:"token"`
+	RefreshToken string `bson:"refreshToken" json:"refreshToken"`
+	ExpiresIn    int64  `bson:"expiresIn" json:"expiresIn"`
+	MFARequired  bool   `bson:"mfaRequired" json:"mfaRequired,omitempty"`
+	MFAToken     string `bson:"mfaToken" json:"mfaToken,omitempty"`
+	Reactivated  bool   `bson:"reactivated" json:"reactivated,omitempty"`
 }
 
 type LoginResponse struct {
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// UserMFA holds the TOTP two-factor settings of a user. The secrets are
+// stored encrypted and the recovery codes as SHA-256 hashes. LastUsedStep is
+// the last accepted TOTP time step, codes cannot be used twice.
+type UserMFA struct {
+	Enabled       bool       `bson:"enabled"`
+	Secret        string     `bson:"secret,omitempty"`
+	PendingSecret string     `bson:"pendingSecret,omitempty"`
+	RecoveryCodes []string   `bson:"recoveryCodes,omitempty"`
+	LastUsedStep  int64      `bson:"lastUsedStep"`
+	EnabledAt     *time.Time `bson:"enabledAt,omitempty"`
+}
+
+type MFASetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFADisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFARecoveryCodesRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	LoginCodePurposeLogin       = "login"
+	LoginCodePurposeLink        = "link"
+	LoginCodePurposeLinkConfirm = "link_confirm"
+)
+
+// LoginCode is a short-lived single-use code. Login codes are handed to the
+// frontend after an OAuth login and exchanged for tokens through POST
+// /auth/exchange, link codes start the provider login that links an identity
+// to the user and link confirmation codes hold the provider account until the
+// user confirms it. Only the SHA-256 hash of the code is stored.
+type LoginCode struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	Purpose   string             `bson:"purpose"`
+	CodeHash  string             `bson:"codeHash"`
+	Identity  *LinkedIdentity    `bson:"identity,omitempty"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+type ExchangeCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type LinkIdentityRequest struct {
+	Password   string `json:"password"`
+	RedirectTo string `json:"redirectTo"`
+}
+
+type LinkIdentityResponse struct {
+	URL string `json:"url"`
+}
+
+type ConfirmLinkResponse struct {
+	Provider string `json:"provider"`
+}
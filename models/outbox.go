@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+// OutboxEmail is an email queued for delivery by the outbox worker. Emails
+// failing MaxAttempts times end up in the dead status.
+type OutboxEmail struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	To            string             `bson:"to" json:"to"`
+	Subject       string             `bson:"subject" json:"subject"`
+	TextBody      string             `bson:"textBody" json:"-"`
+	HTMLBody      string             `bson:"htmlBody" json:"-"`
+	Status        string             `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	MaxAttempts   int                `bson:"maxAttempts" json:"maxAttempts"`
+	NextAttemptAt time.Time          `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	LockedUntil   *time.Time         `bson:"lockedUntil" json:"-"`
+	LastError     string             `bson:"lastError" json:"lastError"`
+	SentAt        *time.Time         `bson:"sentAt" json:"sentAt"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     *time.Time         `bson:"updatedAt" json:"updatedAt"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PasswordReset is a single-use password reset token. Only the SHA-256 hash
+// of the emailed token is stored.
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	TokenHash string             `bson:"tokenHash"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// SetPasswordRequest sets the first password of an account registered with
+// an external provider, or changes it when CurrentPassword is given
+type SetPasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password" binding:"required"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// ProfileResponse is the profile of the current user returned by /me
+type ProfileResponse struct {
+	ID           string           `json:"id"`
+	FullName     string           `json:"fullName"`
+	DisplayName  string           `json:"displayName"`
+	Email        string           `json:"email"`
+	PendingEmail string           `json:"pendingEmail,omitempty"`
+	AvatarURL    string           `json:"avatarUrl"`
+	Locale       string           `json:"locale"`
+	Timezone     string           `json:"timezone"`
+	Role         string           `json:"role"`
+	IsVerify     bool             `json:"isVerify"`
+	MFAEnabled   bool             `json:"mfaEnabled"`
+	HasPassword  bool             `json:"hasPassword"`
+	Identities   []LinkedIdentity `json:"identities"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	UpdatedAt    *time.Time       `json:"updatedAt"`
+	Version      int64            `json:"version"`
+}
+
+func NewProfileResponse(user User) ProfileResponse {
+	identities := user.Identities
+	if identities == nil {
+		identities = []LinkedIdentity{}
+	}
+	return ProfileResponse{
+		ID:           user.ID.Hex(),
+		FullName:     user.FullName,
+		DisplayName:  user.DisplayName,
+		Email:        user.Email,
+		PendingEmail: user.PendingEmail,
+		AvatarURL:    user.AvatarURL,
+		Locale:       user.Locale,
+		Timezone:     user.Timezone,
+		Role:         user.GetRole(),
+		IsVerify:     user.IsVerify,
+		MFAEnabled:   user.MFAEnabled(),
+		HasPassword:  user.Password != "",
+		Identities:   identities,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		Version:      user.Version,
+	}
+}
+
+// UpdateProfileRequest changes the fields that are present, an empty string
+// clears every field but fullName. When Version is given the update fails
+// with a conflict if the user has been changed since that version.
+type UpdateProfileRequest struct {
+	FullName    *string `json:"fullName" binding:"omitempty,max=100"`
+	DisplayName *string `json:"displayName" binding:"omitempty,max=50"`
+	AvatarURL   *string `json:"avatarUrl" binding:"omitempty,max=2048"`
+	Locale      *string `json:"locale" binding:"omitempty,max=35"`
+	Timezone    *string `json:"timezone" binding:"omitempty,max=64"`
+	Version     *int64  `json:"version" binding:"omitempty,min=0"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PromptScopeCharacter = "character"
+	PromptScopeElement   = "element"
+	PromptScopeDefault   = "default"
+)
+
+// PromptTemplate is a text/template used as the system prompt of character
+// chats. Key is the character ID for the character scope, the lowercased
+// element for the element scope and empty for the default scope.
+type PromptTemplate struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Scope     string             `bson:"scope" json:"scope"`
+	Key       string             `bson:"key" json:"key"`
+	Template  string             `bson:"template" json:"template"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt *time.Time         `bson:"updatedAt" json:"updatedAt"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the token
+// is kept. Every login starts a new family and each refresh rotates the token
+// within that family, so presenting an already rotated token reveals reuse.
+// AuthTime is when the user logged in to start the family.
+type RefreshToken struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty"`
+	UserID        primitive.ObjectID  `bson:"userId"`
+	FamilyID      primitive.ObjectID  `bson:"familyId"`
+	TokenHash     string              `bson:"tokenHash"`
+	AccessTokenID string              `bson:"accessTokenId"`
+	AccessExpires time.Time           `bson:"accessExpiresAt"`
+	UserAgent     string              `bson:"userAgent"`
+	IP            string              `bson:"ip"`
+	AuthTime      time.Time           `bson:"authTime"`
+	ExpiresAt     time.Time           `bson:"expiresAt"`
+	CreatedAt     time.Time           `bson:"createdAt"`
+	RevokedAt     *time.Time          `bson:"revokedAt"`
+	ReplacedBy    *primitive.ObjectID `bson:"replacedBy"`
+}
+
+// RevokedToken is a denylisted access token ID (jti), kept until the token
+// would have expired anyway
+type RevokedToken struct {
+	ID        string             `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+// TokenPair is a new session. Reactivated is set when logging in restored a
+// deactivated account or one waiting for deletion.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	Reactivated  bool   `json:"reactivated,omitempty"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
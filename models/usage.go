@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UsageRecord is the token usage of a single chat completion
+type UsageRecord struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID           primitive.ObjectID `bson:"userId" json:"userId"`
+	ConversationID   primitive.ObjectID `bson:"conversationId" json:"conversationId"`
+	Model            string             `bson:"model" json:"model"`
+	PromptTokens     int                `bson:"promptTokens" json:"promptTokens"`
+	CompletionTokens int                `bson:"completionTokens" json:"completionTokens"`
+	TotalTokens      int                `bson:"totalTokens" json:"totalTokens"`
+	CreatedAt        time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// UsageTotals aggregates usage records over a period
+type UsageTotals struct {
+	Requests         int `bson:"requests" json:"requests"`
+	PromptTokens     int `bson:"promptTokens" json:"promptTokens"`
+	CompletionTokens int `bson:"completionTokens" json:"completionTokens"`
+	TotalTokens      int `bson:"totalTokens" json:"totalTokens"`
+}
+
+// UsagePeriod is the usage of a user for the current day or month. Quota and
+// Remaining are nil when the period is unlimited.
+type UsagePeriod struct {
+	UsageTotals
+	Start     time.Time `json:"start"`
+	ResetAt   time.Time `json:"resetAt"`
+	Quota     *int      `json:"quota"`
+	Remaining *int      `json:"remaining"`
+}
+
+type UsageSummary struct {
+	Daily   UsagePeriod `json:"daily"`
+	Monthly UsagePeriod `json:"monthly"`
+}
@@ -6,15 +6,129 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User is an account. Fields tagged json:"-" are never bound from a request
+// body, they only change through the services that own them
 type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" swaggerignore:"true"`
-	FullName  string             `bson:"fullName"`
-	Email     string             `bson:"email"`
-	Password  string             `bson:"password"`
-	LastLogin *time.Time         `bson:"lastLogin" json:"lastLogin" swaggerignore:"true"`
-	IsGoogle  bool               `bson:"isGoogle" json:"isGoogle" swaggerignore:"true"`
-	IsVerify  bool               `bson:"isVerify"`
-	VerifyAt  *time.Time         `bson:"VerifyAt" json:"VerifyAt" swaggerignore:"true"`
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt" swaggerignore:"true"`
-	UpdatedAt *time.Time         `bson:"updatedAt" json:"updatedAt" swaggerignore:"true"`
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" swaggerignore:"true"`
+	FullName string             `bson:"fullName"`
+	Email    string             `bson:"email"`
+	// PendingEmail waits for confirmation, Email and IsVerify are kept until then
+	PendingEmail string `bson:"pendingEmail,omitempty" json:"-"`
+	// Profile settings, only stored through the validators of UpdateProfile
+	DisplayName string     `bson:"displayName,omitempty" json:"-"`
+	AvatarURL   string     `bson:"avatarUrl,omitempty" json:"-"`
+	Locale      string     `bson:"locale,omitempty" json:"-"`
+	Timezone    string     `bson:"timezone,omitempty" json:"-"`
+	Password    string     `bson:"password"`
+	Role        string     `bson:"role" json:"role" swaggerignore:"true"`
+	LastLogin   *time.Time `bson:"lastLogin" json:"-"`
+	IsGoogle    bool       `bson:"isGoogle" json:"isGoogle" swaggerignore:"true"`
+	// External login providers linked to the account
+	Identities []LinkedIdentity `bson:"identities,omitempty" json:"identities,omitempty" swaggerignore:"true"`
+	// Two-factor settings
+	MFA      *UserMFA   `bson:"mfa,omitempty" json:"-"`
+	IsVerify bool       `bson:"isVerify" json:"-"`
+	VerifyAt *time.Time `bson:"VerifyAt" json:"VerifyAt" swaggerignore:"true"`
+	// Rate limit the resending of verification emails
+	VerificationSentAt    *time.Time `bson:"verificationSentAt" json:"-"`
+	VerificationWindowAt  *time.Time `bson:"verificationWindowAt" json:"-"`
+	VerificationSendCount int        `bson:"verificationSendCount" json:"-"`
+	// Rate limit the password reset emails
+	PasswordResetSentAt   *time.Time `bson:"passwordResetSentAt,omitempty" json:"-"`
+	PasswordResetWindowAt *time.Time `bson:"passwordResetWindowAt,omitempty" json:"-"`
+	PasswordResetCount    int        `bson:"passwordResetCount,omitempty" json:"-"`
+	// Set when the account is locked after repeated failed logins
+	LockedUntil *time.Time `bson:"lockedUntil,omitempty" json:"-"`
+	// Bumped by every update of the editable fields, checked by updates that carry one
+	Version int64 `bson:"version" json:"-"`
+	// Deactivated and deleted accounts have their sessions revoked, deleted ones
+	// are purged at PurgeAt unless a login restores them first
+	DeactivatedAt  *time.Time `bson:"deactivatedAt,omitempty" json:"-"`
+	DeletedAt      *time.Time `bson:"deletedAt,omitempty" json:"-"`
+	DeletedByAdmin bool       `bson:"deletedByAdmin,omitempty" json:"-"`
+	PurgeAt        *time.Time `bson:"purgeAt,omitempty" json:"-"`
+	Purging        bool       `bson:"purging,omitempty" json:"-"`
+	CreatedAt      time.Time  `bson:"createdAt" json:"createdAt" swaggerignore:"true"`
+	UpdatedAt      *time.Time `bson:"updatedAt" json:"updatedAt" swaggerignore:"true"`
+}
+
+// UserResponse is the public representation of a user, without credentials
+type UserResponse struct {
+	ID           string           `json:"id"`
+	FullName     string           `json:"fullName"`
+	Email        string           `json:"email"`
+	PendingEmail string           `json:"pendingEmail,omitempty"`
+	Role         string           `json:"role"`
+	IsGoogle     bool             `json:"isGoogle"`
+	Identities   []LinkedIdentity `json:"identities"`
+	MFAEnabled   bool             `json:"mfaEnabled"`
+	IsVerify     bool             `json:"isVerify"`
+	VerifyAt     *time.Time       `json:"verifyAt"`
+	LastLogin    *time.Time       `json:"lastLogin"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	UpdatedAt    *time.Time       `json:"updatedAt"`
+	Version      int64            `json:"version"`
+}
+
+// GetRole returns the role of the user, defaulting accounts created before
+// roles existed to RoleUser
+func (u User) GetRole() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+// MFAEnabled reports whether logging in requires a second factor
+func (u User) MFAEnabled() bool {
+	return u.MFA != nil && u.MFA.Enabled
+}
+
+func NewUserResponse(user User) UserResponse {
+	return UserResponse{
+		ID:           user.ID.Hex(),
+		FullName:     user.FullName,
+		Email:        user.Email,
+		PendingEmail: user.PendingEmail,
+		Role:         user.GetRole(),
+		IsGoogle:     user.IsGoogle,
+		Identities:   user.Identities,
+		MFAEnabled:   user.MFAEnabled(),
+		IsVerify:     user.IsVerify,
+		VerifyAt:     user.VerifyAt,
+		LastLogin:    user.LastLogin,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		Version:      user.Version,
+	}
+}
+
+// LinkedIdentity is an account of an external login provider, identified by
+// the provider name and the subject the provider uses for the user
+type LinkedIdentity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"subject"`
+	Email    string    `bson:"email" json:"email"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// UpdateUserRequest changes the fields that are present, on top of the ones of
+// UpdateProfileRequest
+type UpdateUserRequest struct {
+	UpdateProfileRequest
+	// Only replaces the current email once the new address is confirmed
+	Email *string `json:"email" binding:"omitempty,email,max=254"`
+	// Only admins can change roles
+	Role *string `json:"role" binding:"omitempty,oneof=user admin"`
+	// Rejected, passwords are changed through /auth/password
+	Password *string `json:"password,omitempty" swaggerignore:"true"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required"`
 }
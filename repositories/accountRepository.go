@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RestoreUser clears the deactivation and deletion of the user. Nothing is
+// matched once the purge of the user has started.
+func RestoreUser(id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "purging": bson.M{"$ne": true}},
+		bson.M{
+			"$unset": bson.M{"deactivatedAt": "", "deletedAt": "", "deletedByAdmin": "", "purgeAt": ""},
+			"$set":   bson.M{"updatedAt": time.Now()},
+		},
+	)
+}
+
+// MarkUserDeletedByAdmin keeps a deleted user from being restored by logging
+// in. Nothing is matched once the user is no longer deleted.
+func MarkUserDeletedByAdmin(id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "deletedAt": bson.M{"$ne": nil}},
+		bson.M{"$set": bson.M{"deletedByAdmin": true, "updatedAt": time.Now()}},
+	)
+}
+
+// ClaimUserToPurge marks a deleted user whose grace period is over as being
+// purged, so logins can no longer restore it, and returns it. Users whose
+// purge was interrupted are claimed again.
+func ClaimUserToPurge() (models.User, error) {
+	var user models.User
+	err := userCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"deletedAt": bson.M{"$exists": true}, "purgeAt": bson.M{"$lte": time.Now()}},
+		bson.M{"$set": bson.M{"purging": true}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	return user, err
+}
+
+// PurgeUser deletes the user along with the conversations, usage, sessions,
+// codes, auth events and queued emails kept about them. The user document
+// goes last so an interrupted purge is picked up again.
+func PurgeUser(ctx context.Context, user models.User) error {
+	byUser := bson.M{"userId": user.ID}
+	for _, collection := range []*mongo.Collection{
+		conversationMessageCollection,
+		conversationCollection,
+		usageCollection,
+		refreshTokenCollection,
+		revokedTokenCollection,
+		passwordResetCollection,
+		loginCodeCollection,
+		authEventCollection,
+	} {
+		if _, err := collection.DeleteMany(ctx, byUser); err != nil {
+			return err
+		}
+	}
+
+	if _, err := authEventCollection.DeleteMany(ctx, bson.M{"email": user.Email}); err != nil {
+		return err
+	}
+	if _, err := outboxCollection.DeleteMany(ctx, bson.M{"to": user.Email}); err != nil {
+		return err
+	}
+
+	_, err := userCollection.DeleteOne(ctx, bson.M{"_id": user.ID, "purging": true})
+	return err
+}
+
+// ListAuthEventsByUser returns the auth events of the user, newest first
+func ListAuthEventsByUser(userID primitive.ObjectID, email string) ([]models.AuthEvent, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"userId": userID}, bson.M{"email": email}}}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := authEventCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AuthEvent{}
+	if err := cursor.All(context.Background(), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateAuthEvent(event models.AuthEvent) (*mongo.InsertOneResult, error) {
+	return authEventCollection.InsertOne(context.Background(), event)
+}
+
+// GetLoginAttempts returns the attempts of the key, ErrNoDocuments when its
+// window is over
+func GetLoginAttempts(key string) (models.LoginAttempts, error) {
+	var attempts models.LoginAttempts
+	err := loginAttemptCollection.FindOne(context.Background(),
+		bson.M{"_id": key, "expiresAt": bson.M{"$gt": time.Now()}},
+	).Decode(&attempts)
+	return attempts, err
+}
+
+// AddLoginAttempt counts a failure for the key, starting a new window when
+// the previous one is over
+func AddLoginAttempt(key string, window time.Duration) (models.LoginAttempts, error) {
+	now := time.Now()
+	var attempts models.LoginAttempts
+	err := loginAttemptCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": key, "expiresAt": bson.M{"$gt": now}},
+		bson.M{"$inc": bson.M{"count": 1}, "$set": bson.M{"lastAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&attempts)
+	if err != mongo.ErrNoDocuments {
+		return attempts, err
+	}
+
+	attempts = models.LoginAttempts{Key: key, Count: 1, LastAt: now, ExpiresAt: now.Add(window)}
+	_, err = loginAttemptCollection.ReplaceOne(context.Background(), bson.M{"_id": key}, attempts, options.Replace().SetUpsert(true))
+	return attempts, err
+}
+
+func DeleteLoginAttempts(key string) error {
+	_, err := loginAttemptCollection.DeleteOne(context.Background(), bson.M{"_id": key})
+	return err
+}
@@ -6,10 +6,23 @@ import (
 	"fmt"
 	"os"
 	"porty-go/models"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/supabase-community/postgrest-go"
 	"github.com/supabase-community/supabase-go"
 )
 
+var (
+	ErrCharacterNotFound = errors.New("character not found")
+	ErrCharacterConflict = errors.New("character conflicts with an existing one")
+	ErrInvalidCharacter  = errors.New("invalid character")
+)
+
+// postgrestErrorPattern matches the "(code) message" errors of postgrest-go
+var postgrestErrorPattern = regexp.MustCompile(`^\(([^)]*)\) (.*)$`)
+
 type CharacterRepository struct {
 	client *supabase.Client
 }
@@ -25,47 +38,89 @@ func NewCharacterRepository() (*CharacterRepository, error) {
 	return &CharacterRepository{client: client}, nil
 }
 
-func (r *CharacterRepository) GetAllCharacters(page, record int, search string) ([]models.Character, error) {
-	var characters []models.Character
+// ListCharacters returns a page of the characters matching the filter along
+// with the exact count of matching characters
+func (r *CharacterRepository) ListCharacters(filter models.CharacterFilter) ([]models.Character, int64, error) {
+	resp, count, err := characterListQuery(r.client.From("characters").Select("*", "exact", false), filter).
+		Range(filter.Offset, filter.Offset+filter.Limit-1, "").
+		Execute()
+	if err != nil {
+		if postgrestErrorCode(err) != "PGRST103" {
+			return nil, 0, characterError(err)
+		}
+		// The page is past the last one, count the matches alone
+		_, count, err = characterListQuery(r.client.From("characters").Select("id", "exact", true), filter).Execute()
+		if err != nil {
+			return nil, 0, characterError(err)
+		}
+		return []models.Character{}, count, nil
+	}
 
-	// Define the RPC parameters
-	params := map[string]interface{}{
-		"search_query": search,
-		"page":         page,
-		"record":       record,
+	characters := []models.Character{}
+	if err := json.Unmarshal(resp, &characters); err != nil {
+		return nil, 0, fmt.Errorf("parsing characters: %w", err)
 	}
+	return characters, count, nil
+}
 
-	// Call the PostgreSQL function via RPC
-	resp := r.client.Rpc("list_characters", "", params)
+// characterListQuery applies the filters and sort of the list. Ranges go in a
+// single and=() as postgrest-go keeps one filter per column.
+func characterListQuery(query *postgrest.FilterBuilder, filter models.CharacterFilter) *postgrest.FilterBuilder {
+	if filter.Search != "" {
+		query = query.Ilike("name", "*"+escapeLikePattern(filter.Search)+"*")
+	}
 
-	// Parse the response
-	err := json.Unmarshal([]byte(resp), &characters)
+	for column, values := range map[string][]string{
+		"element":     filter.Elements,
+		"weapon_type": filter.WeaponTypes,
+		"rarity":      filter.Rarities,
+		"role":        filter.Roles,
+	} {
+		if len(values) > 0 {
+			query = query.In(column, values)
+		}
+	}
 
-	// Check for errors
-	if err != nil {
-		var errorResponse models.SupRpcErrorResponse
-		err := json.Unmarshal([]byte(resp), &errorResponse)
-		// Set default error message if parsing fails
-		if err != nil {
-			return nil, err
+	var conditions []string
+	if filter.ReleasedFrom != "" {
+		conditions = append(conditions, "release_date.gte."+filter.ReleasedFrom)
+	}
+	if filter.ReleasedTo != "" {
+		conditions = append(conditions, "release_date.lte."+filter.ReleasedTo)
+	}
+	for _, statRange := range filter.StatRanges {
+		if statRange.Min != nil {
+			conditions = append(conditions, statRange.Column+".gte."+strconv.Itoa(*statRange.Min))
 		}
-		return nil, errors.New(errorResponse.Message)
+		if statRange.Max != nil {
+			conditions = append(conditions, statRange.Column+".lte."+strconv.Itoa(*statRange.Max))
+		}
+	}
+	if len(conditions) > 0 {
+		query = query.And(strings.Join(conditions, ","), "")
 	}
 
-	return characters, nil
+	for _, sort := range filter.Sort {
+		query = query.Order(sort.Column, &postgrest.OrderOpts{Ascending: !sort.Descending})
+	}
+	return query
 }
 
-func (r *CharacterRepository) GetCharacterByID(id string) (models.Character, error) {
+// escapeLikePattern keeps the search text literal in an ilike filter.
+// PostgREST turns every * into a wildcard so those are dropped.
+func escapeLikePattern(value string) string {
+	value = strings.ReplaceAll(value, "*", "")
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func (r *CharacterRepository) GetCharacterByID(id int) (models.Character, error) {
 	var characters models.Character
 
 	// Fetch a single record from the "characters"
-	resp, _, err := r.client.From("characters").Select("*", "exact", false).Eq("id", id).Single().Execute()
+	resp, _, err := r.client.From("characters").Select("*", "exact", false).Eq("id", strconv.Itoa(id)).Single().Execute()
 	if err != nil {
 		fmt.Println("Error executing query: ", err)
-		if err.Error() == "(PGRST116) JSON object requested, multiple (or no) rows returned" {
-			return characters, errors.New("character not found")
-		}
-		return characters, err
+		return characters, characterError(err)
 	}
 
 	// Parse the JSON response into the characters slice
@@ -77,3 +132,112 @@ func (r *CharacterRepository) GetCharacterByID(id string) (models.Character, err
 
 	return characters, nil
 }
+
+// GetCharactersByIDs returns the characters with the ids that exist, in no
+// particular order
+func (r *CharacterRepository) GetCharactersByIDs(ids []int) ([]models.Character, error) {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.Itoa(id)
+	}
+
+	resp, _, err := r.client.From("characters").Select("*", "", false).In("id", values).Execute()
+	if err != nil {
+		return nil, characterError(err)
+	}
+
+	characters := []models.Character{}
+	if err := json.Unmarshal(resp, &characters); err != nil {
+		return nil, fmt.Errorf("parsing characters: %w", err)
+	}
+	return characters, nil
+}
+
+// CreateCharacter inserts the character and returns the stored row
+func (r *CharacterRepository) CreateCharacter(character models.Character) (models.Character, error) {
+	character.ID = nil
+	character.PublicID = nil
+
+	resp, _, err := r.client.From("characters").Insert(character, false, "", "representation", "").Single().Execute()
+	if err != nil {
+		return models.Character{}, characterError(err)
+	}
+	return decodeCharacter(resp)
+}
+
+// ReplaceCharacter overwrites every column of the character
+func (r *CharacterRepository) ReplaceCharacter(id int, character models.Character) (models.Character, error) {
+	character.ID = nil
+	character.PublicID = nil
+
+	resp, _, err := r.client.From("characters").Update(character, "representation", "").Eq("id", strconv.Itoa(id)).Single().Execute()
+	if err != nil {
+		return models.Character{}, characterError(err)
+	}
+	return decodeCharacter(resp)
+}
+
+// UpdateCharacter sets the columns present in the patch
+func (r *CharacterRepository) UpdateCharacter(id int, patch models.CharacterPatch) (models.Character, error) {
+	resp, _, err := r.client.From("characters").Update(patch, "representation", "").Eq("id", strconv.Itoa(id)).Single().Execute()
+	if err != nil {
+		return models.Character{}, characterError(err)
+	}
+	return decodeCharacter(resp)
+}
+
+// DeleteCharacter deletes the character and returns the deleted row
+func (r *CharacterRepository) DeleteCharacter(id int) (models.Character, error) {
+	resp, _, err := r.client.From("characters").Delete("representation", "").Eq("id", strconv.Itoa(id)).Single().Execute()
+	if err != nil {
+		return models.Character{}, characterError(err)
+	}
+	return decodeCharacter(resp)
+}
+
+func decodeCharacter(resp []byte) (models.Character, error) {
+	var character models.Character
+	if err := json.Unmarshal(resp, &character); err != nil {
+		return models.Character{}, fmt.Errorf("parsing character: %w", err)
+	}
+	return character, nil
+}
+
+// postgrestErrorCode returns the code of a postgrest-go error, empty for
+// other errors
+func postgrestErrorCode(err error) string {
+	match := postgrestErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// characterError maps PostgREST and Postgres error codes to
+// ErrCharacterNotFound, ErrCharacterConflict and ErrInvalidCharacter, keeping
+// the database message. Other errors are returned as they are.
+func characterError(err error) error {
+	match := postgrestErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+
+	code, message := match[1], match[2]
+	switch code {
+	case "PGRST100":
+		// unparsable query
+		return fmt.Errorf("%w: %s", ErrInvalidCharacter, message)
+	case "PGRST116":
+		return ErrCharacterNotFound
+	case "23505", "23503":
+		// unique_violation, foreign_key_violation
+		return fmt.Errorf("%w: %s", ErrCharacterConflict, message)
+	case "23502", "23514", "22001", "22003", "22007", "22008", "22P02", "PGRST102", "PGRST204":
+		// not_null_violation, check_violation, string_data_right_truncation,
+		// numeric_value_out_of_range, invalid_datetime_format,
+		// datetime_field_overflow, invalid_text_representation, invalid body,
+		// unknown column
+		return fmt.Errorf("%w: %s", ErrInvalidCharacter, message)
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateConversation(conversation models.Conversation) (*mongo.InsertOneResult, error) {
+	return conversationCollection.InsertOne(context.Background(), conversation)
+}
+
+func GetConversationByID(id, userID primitive.ObjectID) (models.Conversation, error) {
+	var conversation models.Conversation
+	err := conversationCollection.FindOne(context.Background(), bson.M{"_id": id, "userId": userID}).Decode(&conversation)
+	return conversation, err
+}
+
+func GetCharacterConversation(userID primitive.ObjectID, characterID int) (models.Conversation, error) {
+	var conversation models.Conversation
+	err := conversationCollection.FindOne(context.Background(), bson.M{"userId": userID, "characterId": characterID}).Decode(&conversation)
+	return conversation, err
+}
+
+func ListConversationsByUser(userID primitive.ObjectID) ([]models.Conversation, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "createdAt", Value: -1}})
+	cursor, err := conversationCollection.Find(context.Background(), bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []models.Conversation{}
+	if err := cursor.All(context.Background(), &conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+func UpdateConversationTitle(id, userID primitive.ObjectID, title string) (*mongo.UpdateResult, error) {
+	return conversationCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "userId": userID},
+		bson.M{"$set": bson.M{"title": title, "updatedAt": time.Now()}},
+	)
+}
+
+func TouchConversation(id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return conversationCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"updatedAt": time.Now()}},
+	)
+}
+
+func DeleteConversation(id, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	result, err := conversationCollection.DeleteOne(context.Background(), bson.M{"_id": id, "userId": userID})
+	if err != nil || result.DeletedCount == 0 {
+		return result, err
+	}
+
+	_, err = conversationMessageCollection.DeleteMany(context.Background(), bson.M{"conversationId": id})
+	return result, err
+}
+
+func CreateConversationMessages(messages []models.ConversationMessage) (*mongo.InsertManyResult, error) {
+	docs := make([]interface{}, len(messages))
+	for i, message := range messages {
+		docs[i] = message
+	}
+	return conversationMessageCollection.InsertMany(context.Background(), docs)
+}
+
+// GetConversationMessages returns the latest messages of a conversation in
+// chronological order. A limit of zero returns the whole history.
+func GetConversationMessages(conversationID primitive.ObjectID, limit int64) ([]models.ConversationMessage, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := conversationMessageCollection.Find(context.Background(), bson.M{"conversationId": conversationID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.ConversationMessage{}
+	if err := cursor.All(context.Background(), &messages); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
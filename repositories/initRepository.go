@@ -1,13 +1,107 @@
 package repositories
 
 import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var userCollection *mongo.Collection
 var integrationServiceCollection *mongo.Collection
+var conversationCollection *mongo.Collection
+var conversationMessageCollection *mongo.Collection
+var promptTemplateCollection *mongo.Collection
+var usageCollection *mongo.Collection
+var refreshTokenCollection *mongo.Collection
+var revokedTokenCollection *mongo.Collection
+var passwordResetCollection *mongo.Collection
+var outboxCollection *mongo.Collection
+var loginCodeCollection *mongo.Collection
+var authEventCollection *mongo.Collection
+var loginAttemptCollection *mongo.Collection
 
 func Init(client *mongo.Client) {
 	userCollection = client.Database("tedy").Collection("users")
 	integrationServiceCollection = client.Database("tedy").Collection("integrationService")
+	conversationCollection = client.Database("tedy").Collection("conversations")
+	conversationMessageCollection = client.Database("tedy").Collection("conversationMessages")
+	promptTemplateCollection = client.Database("tedy").Collection("promptTemplates")
+	usageCollection = client.Database("tedy").Collection("aiUsage")
+	refreshTokenCollection = client.Database("tedy").Collection("refreshTokens")
+	revokedTokenCollection = client.Database("tedy").Collection("revokedTokens")
+	passwordResetCollection = client.Database("tedy").Collection("passwordResets")
+	outboxCollection = client.Database("tedy").Collection("emailOutbox")
+	loginCodeCollection = client.Database("tedy").Collection("loginCodes")
+	authEventCollection = client.Database("tedy").Collection("authEvents")
+	loginAttemptCollection = client.Database("tedy").Collection("loginAttempts")
+
+	ensureIndexes()
+}
+
+// authEventRetentionDays is how long login events are kept
+const authEventRetentionDays = 90
+
+// Sent emails are kept a week for support, the others a month so failures can
+// be looked into
+const (
+	outboxSentRetentionDays = 7
+	outboxRetentionDays     = 30
+)
+
+// ensureIndexes creates the lookup and TTL indexes the repositories rely on.
+// Failures are logged only, the queries still work without them.
+func ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexes := map[*mongo.Collection][]mongo.IndexModel{
+		userCollection: {
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "purgeAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{
+				Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+			},
+		},
+		refreshTokenCollection: {
+			{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "accessTokenId", Value: 1}}},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		revokedTokenCollection: {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		loginCodeCollection: {
+			{Keys: bson.D{{Key: "codeHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		authEventCollection: {
+			{Keys: bson.D{{Key: "email", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "createdAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(authEventRetentionDays * 24 * 60 * 60)},
+		},
+		loginAttemptCollection: {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		outboxCollection: {
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+			{Keys: bson.D{{Key: "sentAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(outboxSentRetentionDays * 24 * 60 * 60)},
+			{Keys: bson.D{{Key: "createdAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(outboxRetentionDays * 24 * 60 * 60)},
+		},
+		passwordResetCollection: {
+			{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+			log.Printf("Error creating indexes for %s: %v", collection.Name(), err)
+		}
+	}
 }
@@ -0,0 +1,26 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreateLoginCode(code models.LoginCode) (*mongo.InsertOneResult, error) {
+	return loginCodeCollection.InsertOne(context.Background(), code)
+}
+
+// UseLoginCode marks the unused and unexpired code with the given hash and
+// purpose as used and returns it
+func UseLoginCode(hash, purpose string) (models.LoginCode, error) {
+	now := time.Now()
+	var code models.LoginCode
+	err := loginCodeCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"codeHash": hash, "purpose": purpose, "usedAt": nil, "expiresAt": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&code)
+	return code, err
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SetPendingMFASecret stores the secret of an enrollment not confirmed yet
+func SetPendingMFASecret(id primitive.ObjectID, secret string) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "mfa.enabled": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"mfa.pendingSecret": secret}},
+	)
+}
+
+// EnableMFA turns two-factor on with the confirmed secret, recovery code
+// hashes and the TOTP step used to confirm it
+func EnableMFA(id primitive.ObjectID, secret string, recoveryCodes []string, step int64) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "mfa.enabled": bson.M{"$ne": true}},
+		bson.M{
+			"$set": bson.M{
+				"mfa.enabled":       true,
+				"mfa.secret":        secret,
+				"mfa.recoveryCodes": recoveryCodes,
+				"mfa.lastUsedStep":  step,
+				"mfa.enabledAt":     time.Now(),
+			},
+			"$unset": bson.M{"mfa.pendingSecret": ""},
+		},
+	)
+}
+
+func DisableMFA(id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$unset": bson.M{"mfa": ""}})
+}
+
+// UseTOTPStep records the TOTP step as used, matching nothing when the same
+// or a later step has been used already
+func UseTOTPStep(id primitive.ObjectID, step int64) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "mfa.enabled": true, "mfa.lastUsedStep": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"mfa.lastUsedStep": step}},
+	)
+}
+
+// UseRecoveryCode removes the recovery code hash, matching nothing when the
+// user does not have it
+func UseRecoveryCode(id primitive.ObjectID, hash string) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "mfa.enabled": true, "mfa.recoveryCodes": hash},
+		bson.M{"$pull": bson.M{"mfa.recoveryCodes": hash}},
+	)
+}
+
+func SetRecoveryCodes(id primitive.ObjectID, recoveryCodes []string) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "mfa.enabled": true},
+		bson.M{"$set": bson.M{"mfa.recoveryCodes": recoveryCodes}},
+	)
+}
@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateOutboxEmail(email models.OutboxEmail) (*mongo.InsertOneResult, error) {
+	return outboxCollection.InsertOne(context.Background(), email)
+}
+
+func GetOutboxEmail(id primitive.ObjectID) (models.OutboxEmail, error) {
+	var email models.OutboxEmail
+	err := outboxCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&email)
+	return email, err
+}
+
+// ListOutboxEmails returns the latest emails, optionally filtered by status
+func ListOutboxEmails(status string, limit int64) ([]models.OutboxEmail, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := outboxCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	emails := []models.OutboxEmail{}
+	if err := cursor.All(context.Background(), &emails); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// ClaimOutboxEmail locks the next email due for delivery. Emails left in the
+// sending status by a crashed worker are claimed again once their lock expires.
+func ClaimOutboxEmail(lockFor time.Duration) (models.OutboxEmail, error) {
+	now := time.Now()
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": models.OutboxStatusPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"status": models.OutboxStatusSending, "lockedUntil": bson.M{"$lte": now}},
+	}}
+	update := bson.M{"$set": bson.M{
+		"status":      models.OutboxStatusSending,
+		"lockedUntil": now.Add(lockFor),
+		"updatedAt":   now,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var email models.OutboxEmail
+	err := outboxCollection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&email)
+	return email, err
+}
+
+// MarkOutboxEmailSent records the delivery and drops the bodies, they hold
+// live reset and verification links
+func MarkOutboxEmailSent(id primitive.ObjectID, attempts int) (*mongo.UpdateResult, error) {
+	now := time.Now()
+	return outboxCollection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"status":      models.OutboxStatusSent,
+			"attempts":    attempts,
+			"lockedUntil": nil,
+			"lastError":   "",
+			"sentAt":      now,
+			"updatedAt":   now,
+		},
+		"$unset": bson.M{"textBody": "", "htmlBody": ""},
+	})
+}
+
+// MarkOutboxEmailFailed records a failed attempt, moving the email back to
+// pending with the given next attempt or to the given final status
+func MarkOutboxEmailFailed(id primitive.ObjectID, status string, attempts int, nextAttemptAt time.Time, lastError string) (*mongo.UpdateResult, error) {
+	return outboxCollection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"status":        status,
+		"attempts":      attempts,
+		"nextAttemptAt": nextAttemptAt,
+		"lockedUntil":   nil,
+		"lastError":     lastError,
+		"updatedAt":     time.Now(),
+	}})
+}
+
+// ResetOutboxEmail queues a dead email, or a pending one that already failed,
+// again with a fresh attempt budget. Sent emails are never matched so their
+// links are not delivered twice.
+func ResetOutboxEmail(id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	now := time.Now()
+	return outboxCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "$or": bson.A{
+			bson.M{"status": models.OutboxStatusDead},
+			bson.M{"status": models.OutboxStatusPending, "attempts": bson.M{"$gt": 0}},
+		}},
+		bson.M{"$set": bson.M{
+			"status":        models.OutboxStatusPending,
+			"attempts":      0,
+			"nextAttemptAt": now,
+			"lockedUntil":   nil,
+			"updatedAt":     now,
+		}},
+	)
+}
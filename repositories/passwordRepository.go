@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreatePasswordReset(reset models.PasswordReset) (*mongo.InsertOneResult, error) {
+	return passwordResetCollection.InsertOne(context.Background(), reset)
+}
+
+func GetPasswordResetByHash(hash string) (models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := passwordResetCollection.FindOne(context.Background(), bson.M{"tokenHash": hash}).Decode(&reset)
+	return reset, err
+}
+
+// UsePasswordReset marks the reset as used, only if it has not been used yet
+func UsePasswordReset(id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return passwordResetCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "usedAt": nil},
+		bson.M{"$set": bson.M{"usedAt": time.Now()}},
+	)
+}
+
+// InvalidatePasswordResets marks every pending reset of the user as used
+func InvalidatePasswordResets(userID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return passwordResetCollection.UpdateMany(context.Background(),
+		bson.M{"userId": userID, "usedAt": nil},
+		bson.M{"$set": bson.M{"usedAt": time.Now()}},
+	)
+}
+
+func UpdateUserPassword(id primitive.ObjectID, hashedPassword string) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"password": hashedPassword, "updatedAt": time.Now()}},
+	)
+}
@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func GetPromptTemplate(scope, key string) (models.PromptTemplate, error) {
+	var template models.PromptTemplate
+	err := promptTemplateCollection.FindOne(context.Background(), bson.M{"scope": scope, "key": key}).Decode(&template)
+	return template, err
+}
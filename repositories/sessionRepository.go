@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateRefreshToken(token models.RefreshToken) (*mongo.InsertOneResult, error) {
+	return refreshTokenCollection.InsertOne(context.Background(), token)
+}
+
+func GetRefreshTokenByHash(hash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := refreshTokenCollection.FindOne(context.Background(), bson.M{"tokenHash": hash}).Decode(&token)
+	return token, err
+}
+
+func GetRefreshTokenByAccessID(accessTokenID string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := refreshTokenCollection.FindOne(context.Background(), bson.M{"accessTokenId": accessTokenID}).Decode(&token)
+	return token, err
+}
+
+// RotateRefreshToken marks the token as replaced, only if it is still active
+// so two concurrent refreshes cannot both succeed
+func RotateRefreshToken(id, replacedBy primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return refreshTokenCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": time.Now(), "replacedBy": replacedBy}},
+	)
+}
+
+// ListActiveRefreshTokens returns the unrevoked tokens matching filter
+func ListActiveRefreshTokens(filter bson.M) ([]models.RefreshToken, error) {
+	filter["revokedAt"] = nil
+	cursor, err := refreshTokenCollection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []models.RefreshToken{}
+	if err := cursor.All(context.Background(), &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func RevokeRefreshTokens(filter bson.M) (*mongo.UpdateResult, error) {
+	filter["revokedAt"] = nil
+	return refreshTokenCollection.UpdateMany(context.Background(), filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+}
+
+func CreateRevokedToken(token models.RevokedToken) error {
+	opts := options.Update().SetUpsert(true)
+	_, err := revokedTokenCollection.UpdateOne(context.Background(),
+		bson.M{"_id": token.ID},
+		bson.M{"$setOnInsert": token},
+		opts,
+	)
+	return err
+}
+
+func IsTokenRevoked(id string) (bool, error) {
+	count, err := revokedTokenCollection.CountDocuments(context.Background(), bson.M{"_id": id}, options.Count().SetLimit(1))
+	return count > 0, err
+}
@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"context"
+	"porty-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreateUsageRecord(record models.UsageRecord) (*mongo.InsertOneResult, error) {
+	return usageCollection.InsertOne(context.Background(), record)
+}
+
+// SumUsageSince aggregates the usage records of the user created at or after since
+func SumUsageSince(userID primitive.ObjectID, since time.Time) (models.UsageTotals, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": userID, "createdAt": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":              nil,
+			"requests":         bson.M{"$sum": 1},
+			"promptTokens":     bson.M{"$sum": "$promptTokens"},
+			"completionTokens": bson.M{"$sum": "$completionTokens"},
+			"totalTokens":      bson.M{"$sum": "$totalTokens"},
+		}}},
+	}
+
+	cursor, err := usageCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return models.UsageTotals{}, err
+	}
+
+	var results []models.UsageTotals
+	if err := cursor.All(context.Background(), &results); err != nil {
+		return models.UsageTotals{}, err
+	}
+	if len(results) == 0 {
+		return models.UsageTotals{}, nil
+	}
+	return results[0], nil
+}
@@ -7,6 +7,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func CreateUser(user models.User) (*mongo.InsertOneResult, error) {
@@ -25,10 +26,81 @@ func GetUserByEmail(email string) (models.User, error) {
 	return user, err
 }
 
-func UpdateUserById(id primitive.ObjectID, user models.User) (*mongo.UpdateResult, error) {
-	return userCollection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": user})
+// GetUserByIdentity returns the user the provider account is linked to
+func GetUserByIdentity(provider, subject string) (models.User, error) {
+	var user models.User
+	err := userCollection.FindOne(context.Background(), bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+	}).Decode(&user)
+	return user, err
 }
 
-func DeleteUser(id primitive.ObjectID) (*mongo.DeleteResult, error) {
-	return userCollection.DeleteOne(context.Background(), bson.M{"_id": id})
+// AddUserIdentity links the provider account to the user along with the other
+// fields to set. Nothing is matched when the user already has an account of
+// that provider linked.
+func AddUserIdentity(id primitive.ObjectID, identity models.LinkedIdentity, fields bson.M) (*mongo.UpdateResult, error) {
+	update := bson.M{"$push": bson.M{"identities": identity}}
+	if len(fields) > 0 {
+		update["$set"] = fields
+	}
+	filter := bson.M{"_id": id, "identities.provider": bson.M{"$ne": identity.Provider}}
+	return userCollection.UpdateOne(context.Background(), filter, update)
+}
+
+// RemoveUserIdentity unlinks the account of the provider from the user along
+// with setting the other fields
+func RemoveUserIdentity(id primitive.ObjectID, provider string, fields bson.M) (*mongo.UpdateResult, error) {
+	update := bson.M{"$pull": bson.M{"identities": bson.M{"provider": provider}}}
+	if len(fields) > 0 {
+		update["$set"] = fields
+	}
+	return userCollection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+}
+
+// UpdateUserFields sets only the given fields of the user
+func UpdateUserFields(id primitive.ObjectID, fields bson.M) (*mongo.UpdateResult, error) {
+	return userCollection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": fields})
+}
+
+// ConfirmPendingEmail replaces the email of the user with its pending email
+// when it is still the given one, marking it verified. mongo.ErrNoDocuments
+// is returned when that email is no longer pending.
+func ConfirmPendingEmail(id primitive.ObjectID, email string, fields bson.M) (models.User, error) {
+	fields["email"] = email
+	fields["isVerify"] = true
+	update := bson.M{
+		"$set":   fields,
+		"$unset": bson.M{"pendingEmail": ""},
+		"$inc":   bson.M{"version": 1},
+	}
+
+	var user models.User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": id, "pendingEmail": email}, update, opts).Decode(&user)
+	return user, err
+}
+
+// UpdateUserVersioned sets and unsets the given fields of the user and bumps
+// its version, returning the updated user. When version is not nil only the
+// user at that version is matched, users saved before versions existed are at
+// version 0. mongo.ErrNoDocuments is returned when nothing matched.
+func UpdateUserVersioned(id primitive.ObjectID, version *int64, set, unset bson.M) (models.User, error) {
+	filter := bson.M{"_id": id}
+	if version != nil {
+		if *version == 0 {
+			filter["$or"] = bson.A{bson.M{"version": 0}, bson.M{"version": bson.M{"$exists": false}}}
+		} else {
+			filter["version"] = *version
+		}
+	}
+
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var user models.User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&user)
+	return user, err
 }
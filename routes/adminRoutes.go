@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"porty-go/controllers"
+	middleware "porty-go/middlewares"
+	"porty-go/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRoutes defines the administration routes, rate limited by limit
+func AdminRoutes(r *gin.Engine, limit gin.HandlerFunc) {
+	protected := r.Group("/admin")
+	protected.Use(middleware.JWTAuth(), limit, middleware.RequireRole(models.RoleAdmin))
+	{
+		protected.GET("/emails", controllers.ListOutboxEmails)
+		protected.POST("/emails/:id/resend", controllers.ResendOutboxEmail)
+	}
+}
@@ -4,14 +4,15 @@ import (
 	"fmt"
 	"porty-go/controllers"
 	middleware "porty-go/middlewares"
+	"porty-go/models"
 	"porty-go/repositories"
 	"porty-go/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CharacterRoutes defines the character-related routes
-func CharacterRoutes(r *gin.Engine) {
+// CharacterRoutes defines the character-related routes, rate limited by limit
+func CharacterRoutes(r *gin.Engine, limit gin.HandlerFunc) {
 	repo, err := repositories.NewCharacterRepository()
 	if err != nil {
 		fmt.Println("Failed to create a new character repository: ", err)
@@ -26,9 +27,28 @@ func CharacterRoutes(r *gin.Engine) {
 	characterController := controllers.NewCharacterController(services.NewCharacterService(repo))
 
 	protected := r.Group("/characters")
-	protected.Use(middleware.JWTAuth())
+	protected.Use(middleware.JWTAuth(), limit)
 	{
-		protected.GET("/", characterController.ListAllCharacters)
+		protected.GET("/", characterController.ListCharacters)
+		protected.POST("/compare", characterController.CompareCharacters)
 		protected.GET("/:id", characterController.GetCharacterByID)
+		protected.GET("/:id/chat", characterController.GetCharacterChat)
+		protected.POST("/:id/chat", characterController.ChatWithCharacter)
+	}
+
+	admin := protected.Group("")
+	admin.Use(middleware.RequireRole(models.RoleAdmin))
+	{
+		admin.POST("/", characterController.CreateCharacter)
+		admin.PUT("/:id", characterController.ReplaceCharacter)
+		admin.PATCH("/:id", characterController.UpdateCharacter)
+		admin.DELETE("/:id", characterController.DeleteCharacter)
+	}
+
+	// Teams are built from characters and share their controller
+	teams := r.Group("/teams")
+	teams.Use(middleware.JWTAuth(), limit)
+	{
+		teams.POST("/analyze", characterController.AnalyzeTeam)
 	}
 }
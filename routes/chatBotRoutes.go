@@ -7,11 +7,16 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// CharacterRoutes defines the character-related routes
-func AiRoutes(r *gin.Engine) {
+// AiRoutes defines the chatbot-related routes, rate limited by limit
+func AiRoutes(r *gin.Engine, limit gin.HandlerFunc) {
 	protected := r.Group("/chat")
-	protected.Use(middleware.JWTAuth())
+	protected.Use(middleware.JWTAuth(), limit)
 	{
 		protected.POST("/", controllers.ChatAi)
+		protected.GET("/usage", controllers.GetUsage)
+		protected.GET("/conversations", controllers.ListConversations)
+		protected.GET("/conversations/:id", controllers.GetConversation)
+		protected.PUT("/conversations/:id", controllers.RenameConversation)
+		protected.DELETE("/conversations/:id", controllers.DeleteConversation)
 	}
 }
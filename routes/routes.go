@@ -1,14 +1,24 @@
 package routes
 
 import (
+	middleware "porty-go/middlewares"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter(r *gin.Engine) {
-	// Register user routes
-	UserRoutes(r)
+	// Register user routes, anonymous authentication requests are limited by IP
+	UserRoutes(r,
+		middleware.RateLimit(middleware.RateLimitConfig{Burst: 20, Rate: 10, Period: time.Minute}),
+		middleware.RateLimit(middleware.RateLimitConfig{Burst: 30, Rate: 60, Period: time.Minute}),
+	)
 	// Register character routes
-	CharacterRoutes(r)
-	// Register AI routes
-	AiRoutes(r)
+	CharacterRoutes(r, middleware.RateLimit(middleware.RateLimitConfig{Burst: 30, Rate: 60, Period: time.Minute}))
+	// Register AI routes, each chat message is a paid completion
+	AiRoutes(r, middleware.RateLimit(middleware.RateLimitConfig{Burst: 10, Rate: 20, Period: time.Minute}))
+	// Register the keys other services verify tokens with
+	WellKnownRoutes(r)
+	// Register admin routes
+	AdminRoutes(r, middleware.RateLimit(middleware.RateLimitConfig{Burst: 30, Rate: 60, Period: time.Minute}))
 }
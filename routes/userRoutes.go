@@ -2,20 +2,66 @@ package routes
 
 import (
 	"porty-go/controllers"
+	middleware "porty-go/middlewares"
 
 	"github.com/gin-gonic/gin"
 )
 
-// UserRoutes defines the user-related routes
-func UserRoutes(r *gin.Engine) {
-	r.GET("/users/:id", controllers.GetUser)
-	r.GET("/users/verify/:id", controllers.VerifyEmail)
-	r.PUT("/users/:id", controllers.UpdateUser)
-	r.DELETE("/users/:id", controllers.DeleteUser)
+// UserRoutes defines the user-related routes. authLimit rate limits the
+// authentication routes and userLimit the user routes.
+func UserRoutes(r *gin.Engine, authLimit, userLimit gin.HandlerFunc) {
+	r.GET("/users/verify/:id", authLimit, controllers.VerifyEmail)
 
-	// Google OAuth routes
-	r.POST("/auth/register", controllers.RegisterUser)
-	r.POST("/auth/login", controllers.LoginUser)
-	r.GET("/auth/google/login", controllers.GoogleLogin)
-	r.GET("/auth/google/callback", controllers.GoogleCallback)
+	protected := r.Group("/users")
+	protected.Use(middleware.JWTAuth(), userLimit, middleware.RequireSelfOrAdmin("id"))
+	{
+		protected.GET("/:id", controllers.GetUser)
+		protected.PATCH("/:id", controllers.UpdateUser)
+		// PUT is kept for older clients and updates partially as well
+		protected.PUT("/:id", controllers.UpdateUser)
+		protected.DELETE("/:id", controllers.DeleteUser)
+	}
+
+	// Profile of the current user
+	me := r.Group("/me")
+	me.Use(middleware.JWTAuth(), userLimit)
+	{
+		me.GET("", controllers.GetMe)
+		me.PATCH("", controllers.UpdateMe)
+		me.POST("/deactivate", controllers.DeactivateMe)
+		me.GET("/export", controllers.ExportMe)
+	}
+
+	// Auth routes
+	auth := r.Group("/auth")
+	auth.Use(authLimit)
+	{
+		auth.POST("/register", controllers.RegisterUser)
+		auth.POST("/login", controllers.LoginUser)
+		auth.POST("/verify/resend", controllers.ResendVerification)
+		auth.POST("/refresh", controllers.RefreshToken)
+		auth.POST("/logout", middleware.JWTAuth(), controllers.Logout)
+		auth.POST("/logout/all", middleware.JWTAuth(), controllers.LogoutAll)
+		auth.POST("/password/forgot", controllers.ForgotPassword)
+		auth.POST("/password/reset", controllers.ResetPassword)
+		auth.POST("/password", middleware.JWTAuth(), controllers.SetPassword)
+		auth.GET("/:provider/login", controllers.OAuthLogin)
+		auth.GET("/:provider/callback", controllers.OAuthCallback)
+		auth.POST("/:provider/link", middleware.JWTAuth(), controllers.LinkIdentity)
+		auth.DELETE("/:provider/link", middleware.JWTAuth(), controllers.UnlinkIdentity)
+		auth.GET("/identities", middleware.JWTAuth(), controllers.ListIdentities)
+		auth.POST("/identities/confirm", middleware.JWTAuth(), controllers.ConfirmIdentityLink)
+		auth.POST("/exchange", controllers.ExchangeLoginCode)
+	}
+
+	// Two-factor authentication routes
+	auth.POST("/mfa/verify", controllers.VerifyMFA)
+	mfa := auth.Group("/mfa")
+	mfa.Use(middleware.JWTAuth())
+	{
+		mfa.POST("/setup", controllers.SetupMFA)
+		mfa.POST("/enable", controllers.EnableMFA)
+		mfa.POST("/disable", controllers.DisableMFA)
+		mfa.POST("/recovery-codes", controllers.RegenerateRecoveryCodes)
+	}
 }
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"porty-go/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WellKnownRoutes defines the /.well-known discovery routes
+func WellKnownRoutes(r *gin.Engine) {
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
+}
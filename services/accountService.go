@@ -0,0 +1,297 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultAccountDeletionGrace = 30 * 24 * time.Hour
+	accountPurgeInterval        = time.Hour
+)
+
+var (
+	ErrAccountDeleted     = errors.New("this account has been deleted")
+	ErrAccountDeactivated = errors.New("this account is already deactivated")
+)
+
+// DeleteAccount is the deletion of the user by an admin, see deleteAccount
+func DeleteAccount(id string) (time.Time, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return time.Time{}, ErrUserNotFound
+	}
+	user, err := repositories.GetUserById(objID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return time.Time{}, ErrUserNotFound
+		}
+		return time.Time{}, err
+	}
+	return deleteAccount(user, true)
+}
+
+// DeleteOwnAccount re-authenticates the user, then deletes their account
+func DeleteOwnAccount(userID primitive.ObjectID, accessTokenID, password, ip, userAgent string) (time.Time, error) {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return time.Time{}, ErrUserNotFound
+		}
+		return time.Time{}, err
+	}
+	if err := Reauthenticate(user, accessTokenID, password, ip, userAgent); err != nil {
+		return time.Time{}, err
+	}
+	return deleteAccount(user, false)
+}
+
+// deleteAccount schedules the user for deletion after ACCOUNT_DELETION_GRACE
+// and ends their sessions. Logging in before then restores an account the
+// user deleted, accounts deleted by an admin stay deleted. Deleting an
+// account twice keeps the first date, an admin deleting an account its user
+// already deleted only stops it from being restored.
+func deleteAccount(user models.User, byAdmin bool) (time.Time, error) {
+	if user.DeletedAt != nil && user.PurgeAt != nil {
+		if !byAdmin || user.DeletedByAdmin {
+			return *user.PurgeAt, nil
+		}
+
+		result, err := repositories.MarkUserDeletedByAdmin(user.ID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		// Nothing matched when a login restored the account meanwhile, it is
+		// deleted again below
+		if result.MatchedCount > 0 {
+			recordAuthEvent(models.AuthEventAccountDeleted, &user.ID, user.Email, "", "", "deleted by an admin")
+			if err := SendAccountDeletedEmail(user.Email, user.FullName, *user.PurgeAt, false); err != nil {
+				log.Println("Error sending account deleted email:", err)
+			}
+			return *user.PurgeAt, nil
+		}
+	}
+
+	now := time.Now()
+	purgeAt := now.Add(durationFromEnv("ACCOUNT_DELETION_GRACE", defaultAccountDeletionGrace))
+	fields := bson.M{"deletedAt": now, "purgeAt": purgeAt, "updatedAt": now}
+	if byAdmin {
+		fields["deletedByAdmin"] = true
+	}
+	if _, err := repositories.UpdateUserFields(user.ID, fields); err != nil {
+		return time.Time{}, err
+	}
+	if err := LogoutAllSessions(user.ID); err != nil {
+		return time.Time{}, err
+	}
+
+	reason := "deleted by the user"
+	if byAdmin {
+		reason = "deleted by an admin"
+	}
+	recordAuthEvent(models.AuthEventAccountDeleted, &user.ID, user.Email, "", "", reason)
+	if err := SendAccountDeletedEmail(user.Email, user.FullName, purgeAt, !byAdmin); err != nil {
+		log.Println("Error sending account deleted email:", err)
+	}
+	return purgeAt, nil
+}
+
+// DeactivateAccount re-authenticates the user, then ends their sessions until
+// they log in again
+func DeactivateAccount(userID primitive.ObjectID, accessTokenID, password, ip, userAgent string) error {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if user.DeactivatedAt != nil {
+		return ErrAccountDeactivated
+	}
+	if err := Reauthenticate(user, accessTokenID, password, ip, userAgent); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := repositories.UpdateUserFields(user.ID, bson.M{"deactivatedAt": now, "updatedAt": now}); err != nil {
+		return err
+	}
+	if err := LogoutAllSessions(user.ID); err != nil {
+		return err
+	}
+	recordAuthEvent(models.AuthEventAccountDeactivated, &user.ID, user.Email, ip, userAgent, "")
+	return nil
+}
+
+// reactivateOnLogin restores a deactivated account, or one the user deleted
+// that has not been purged yet, when the user logs in. It reports whether the
+// account was restored.
+func reactivateOnLogin(user models.User, ip, userAgent string) (bool, error) {
+	if user.DeactivatedAt == nil && user.DeletedAt == nil {
+		return false, nil
+	}
+	if user.DeletedByAdmin {
+		return false, ErrAccountDeleted
+	}
+
+	result, err := repositories.RestoreUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, ErrAccountDeleted
+	}
+	recordAuthEvent(models.AuthEventAccountReactivated, &user.ID, user.Email, ip, userAgent, "")
+	return true, nil
+}
+
+// StartAccountPurgeWorker deletes the data of the accounts whose deletion
+// grace period is over until ctx is done
+func StartAccountPurgeWorker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(accountPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purgeDeletedAccounts(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// purgeDeletedAccounts purges every account currently due
+func purgeDeletedAccounts(ctx context.Context) {
+	for ctx.Err() == nil {
+		user, err := repositories.ClaimUserToPurge()
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				log.Println("Error claiming account to purge:", err)
+			}
+			return
+		}
+
+		user.Email = strings.ToLower(user.Email)
+		if err := repositories.PurgeUser(ctx, user); err != nil {
+			log.Println("Error purging account:", user.ID.Hex(), err)
+			return
+		}
+		log.Println("Purged deleted account:", user.ID.Hex())
+	}
+}
+
+// ExportUserData collects the personal data kept about the user: the
+// profile, the conversations with their messages and the auth events
+func ExportUserData(userID primitive.ObjectID, ip, userAgent string) (models.UserExport, error) {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.UserExport{}, ErrUserNotFound
+		}
+		return models.UserExport{}, err
+	}
+
+	conversations, err := repositories.ListConversationsByUser(userID)
+	if err != nil {
+		return models.UserExport{}, err
+	}
+	details := make([]models.ConversationDetail, 0, len(conversations))
+	for _, conversation := range conversations {
+		messages, err := repositories.GetConversationMessages(conversation.ID, 0)
+		if err != nil {
+			return models.UserExport{}, err
+		}
+		details = append(details, models.ConversationDetail{Conversation: conversation, Messages: messages})
+	}
+
+	events, err := repositories.ListAuthEventsByUser(userID, strings.ToLower(user.Email))
+	if err != nil {
+		return models.UserExport{}, err
+	}
+
+	recordAuthEvent(models.AuthEventDataExported, &user.ID, user.Email, ip, userAgent, "")
+	return models.UserExport{
+		ExportedAt:    time.Now(),
+		Profile:       models.NewProfileResponse(user),
+		LastLogin:     user.LastLogin,
+		VerifyAt:      user.VerifyAt,
+		Conversations: details,
+		AuthEvents:    events,
+	}, nil
+}
+
+// WriteUserExportZip writes the export as a zip with one JSON file per part
+func WriteUserExportZip(w io.Writer, export models.UserExport) error {
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", struct {
+			ExportedAt time.Time              `json:"exportedAt"`
+			Profile    models.ProfileResponse `json:"profile"`
+			LastLogin  *time.Time             `json:"lastLogin"`
+			VerifyAt   *time.Time             `json:"verifyAt"`
+		}{export.ExportedAt, export.Profile, export.LastLogin, export.VerifyAt}},
+		{"conversations.json", export.Conversations},
+		{"auth_events.json", export.AuthEvents},
+	}
+
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func SendAccountDeletedEmail(to, name string, purgeAt time.Time, canRestore bool) error {
+	if name == "" {
+		name = to
+	}
+
+	data := struct {
+		Name       string
+		PurgeAt    string
+		CanRestore bool
+		LoginLink  string
+	}{
+		Name:       name,
+		PurgeAt:    purgeAt.UTC().Format("January 2, 2006"),
+		CanRestore: canRestore,
+		LoginLink:  GetFrontendURL() + "/auth/login",
+	}
+
+	body := "Your Porty!!! account has been deleted and its data will be erased on " + data.PurgeAt + "."
+	if canRestore {
+		body += " Log in before then to keep your account: " + data.LoginLink
+	}
+	return sendTemplateEmail(to, "Your Porty!!! account has been deleted", body, "templates/account_deleted_email.html", data)
+}
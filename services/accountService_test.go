@@ -0,0 +1,63 @@
+package services
+
+import (
+	"io"
+	"log"
+	"porty-go/repositories"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// mockRepositories points the repositories at a mock deployment, which answers
+// with the responses added to the returned T
+func mockRepositories(t *testing.T) *mtest.T {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ShareClient(true))
+
+	// Index creation fails against the mock, which is only logged
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	repositories.Init(mt.Client)
+	log.SetOutput(output)
+	mt.ClearEvents()
+	return mt
+}
+
+func TestAdminDeleteOfSelfDeletedAccountStopsRestore(t *testing.T) {
+	mt := mockRepositories(t)
+	id := primitive.NewObjectID()
+	deletedAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	purgeAt := deletedAt.Add(30 * 24 * time.Hour)
+	mt.AddMockResponses(
+		mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "email", Value: "player@example.com"},
+			{Key: "deletedAt", Value: deletedAt},
+			{Key: "purgeAt", Value: purgeAt},
+		}),
+		bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		mtest.CreateSuccessResponse(),
+		mtest.CreateSuccessResponse(),
+	)
+
+	got, err := DeleteAccount(id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(purgeAt) {
+		t.Errorf("purge date = %v, want the first one %v", got, purgeAt)
+	}
+
+	mt.GetStartedEvent()
+	update := mt.GetStartedEvent()
+	if update == nil || update.CommandName != "update" {
+		t.Fatalf("second command = %v, want the update", update)
+	}
+	set, err := update.Command.LookupErr("updates", "0", "u", "$set", "deletedByAdmin")
+	if err != nil || !set.Boolean() {
+		t.Errorf("update = %s, want deletedByAdmin set", update.Command)
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"porty-go/models"
+	"strings"
+)
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 1024
+)
+
+type AnthropicRequest struct {
+	Model     string    `json:"model"`
+	System    string    `json:"system,omitempty"`
+	Messages  []Message `json:"messages"`
+	MaxTokens int       `json:"max_tokens"`
+	Stream    bool      `json:"stream,omitempty"`
+}
+
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type AnthropicResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      AnthropicUsage `json:"usage"`
+}
+
+// AnthropicStreamEvent covers the fields used from the streamed event types
+// (message_start, content_block_delta, message_delta and error)
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		Model string         `json:"model"`
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta *struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage *AnthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicProvider talks to Anthropic messages-style endpoints
+type anthropicProvider struct {
+	service models.IntegrationService
+	client  *http.Client
+}
+
+func (p *anthropicProvider) headers() map[string]string {
+	return map[string]string{
+		"x-api-key":         p.service.Token,
+		"anthropic-version": anthropicVersion,
+	}
+}
+
+// request moves system messages into the dedicated system field since the
+// messages API only accepts user and assistant turns
+func (p *anthropicProvider) request(messages []Message, stream bool) AnthropicRequest {
+	data := AnthropicRequest{
+		Model:     p.service.Model,
+		Messages:  []Message{},
+		MaxTokens: p.service.MaxTokens,
+		Stream:    stream,
+	}
+	if data.MaxTokens <= 0 {
+		data.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	var system []string
+	for _, message := range messages {
+		if message.Role == "system" {
+			system = append(system, message.Content)
+			continue
+		}
+		data.Messages = append(data.Messages, message)
+	}
+	data.System = strings.Join(system, "\n\n")
+	return data
+}
+
+func (p *anthropicProvider) Complete(ctx context.Context, messages []Message) (*ChatCompletion, error) {
+	resp, err := postJSON(ctx, p.client, p.service.ServiceUrl, p.headers(), p.request(messages, false))
+	if err != nil {
+		return nil, err
+	}
+
+	var botResp AnthropicResponse
+	if err := decodeJSONResponse(resp, &botResp); err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	for _, block := range botResp.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	return checkCompletion(&ChatCompletion{
+		Content: content.String(),
+		Model:   botResp.Model,
+		Usage:   botResp.Usage.tokenUsage(),
+	})
+}
+
+func (p *anthropicProvider) Stream(ctx context.Context, messages []Message, onDelta func(delta string) error) (*ChatCompletion, error) {
+	headers := p.headers()
+	headers["Accept"] = "text/event-stream"
+	resp, err := postJSON(ctx, p.client, p.service.ServiceUrl, headers, p.request(messages, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var usage AnthropicUsage
+	completion := &ChatCompletion{}
+	err = scanSSEData(resp.Body, func(payload string) (bool, error) {
+		var event AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			fmt.Println("Error unmarshalling stream event:", err)
+			return false, err
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				completion.Model = event.Message.Model
+				usage.InputTokens = event.Message.Usage.InputTokens
+			}
+		case "content_block_delta":
+			if event.Delta != nil {
+				return false, emitDelta(&content, event.Delta.Text, onDelta)
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			return true, nil
+		case "error":
+			if event.Error != nil {
+				return false, errors.New(event.Error.Message)
+			}
+			return false, errors.New("chat service stream failed")
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	completion.Content = content.String()
+	completion.Usage = usage.tokenUsage()
+	return checkCompletion(completion)
+}
+
+func (u AnthropicUsage) tokenUsage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"log"
+	"os"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AttemptStore counts failed logins per key within fixed windows
+type AttemptStore interface {
+	// Get returns the attempts of the key, with a zero count when there are
+	// none in the current window
+	Get(key string) (models.LoginAttempts, error)
+	// Add counts a failure, starting a new window when the previous one is over
+	Add(key string, window time.Duration) (models.LoginAttempts, error)
+	Reset(key string) error
+}
+
+// NewAttemptStoreFromEnv returns the store selected by LOGIN_ATTEMPT_STORE:
+// "mongo" shares the counters between instances, anything else keeps them in
+// memory
+func NewAttemptStoreFromEnv() AttemptStore {
+	switch strings.ToLower(os.Getenv("LOGIN_ATTEMPT_STORE")) {
+	case "mongo":
+		return MongoAttemptStore{}
+	default:
+		log.Println("Counting login attempts in memory")
+		return NewMemoryAttemptStore()
+	}
+}
+
+// MongoAttemptStore keeps the counters in the loginAttempts collection
+type MongoAttemptStore struct{}
+
+func (MongoAttemptStore) Get(key string) (models.LoginAttempts, error) {
+	attempts, err := repositories.GetLoginAttempts(key)
+	if err == mongo.ErrNoDocuments {
+		return models.LoginAttempts{Key: key}, nil
+	}
+	return attempts, err
+}
+
+func (MongoAttemptStore) Add(key string, window time.Duration) (models.LoginAttempts, error) {
+	return repositories.AddLoginAttempt(key, window)
+}
+
+func (MongoAttemptStore) Reset(key string) error {
+	return repositories.DeleteLoginAttempts(key)
+}
+
+// MemoryAttemptStore keeps the counters of a single instance
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+	adds     int
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: map[string]models.LoginAttempts{}}
+}
+
+func (s *MemoryAttemptStore) Get(key string) (models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok || !attempts.ExpiresAt.After(time.Now()) {
+		return models.LoginAttempts{Key: key}, nil
+	}
+	return attempts, nil
+}
+
+func (s *MemoryAttemptStore) Add(key string, window time.Duration) (models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.adds++
+	if s.adds%1000 == 0 {
+		s.purge(now)
+	}
+
+	attempts, ok := s.attempts[key]
+	if !ok || !attempts.ExpiresAt.After(now) {
+		attempts = models.LoginAttempts{Key: key, ExpiresAt: now.Add(window)}
+	}
+	attempts.Count++
+	attempts.LastAt = now
+	s.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// purge drops the windows that are over so the map does not grow forever
+func (s *MemoryAttemptStore) purge(now time.Time) {
+	for key, attempts := range s.attempts {
+		if !attempts.ExpiresAt.After(now) {
+			delete(s.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"porty-go/models"
+	"porty-go/repositories"
+)
+
+var ErrDuplicateCharacterID = errors.New("a character is listed more than once")
+
+// CompareCharacters returns the characters side by side with the difference
+// of their stats from the first one
+func (s *CharacterService) CompareCharacters(ids []string) (models.CharacterComparison, error) {
+	characters, err := s.charactersByPublicIDs(ids)
+	if err != nil {
+		return models.CharacterComparison{}, err
+	}
+
+	baseline := characterStats(characters[0])
+	comparison := models.CharacterComparison{
+		Baseline:   *characters[0].PublicID,
+		Characters: make([]models.CharacterComparisonEntry, 0, len(characters)),
+	}
+	var highest models.CharacterStats
+	for i, character := range characters {
+		stats := characterStats(character)
+		comparison.Characters = append(comparison.Characters, models.CharacterComparisonEntry{
+			Character: character,
+			Stats:     stats,
+			Delta: models.CharacterStats{
+				Attack:  stats.Attack - baseline.Attack,
+				Defense: stats.Defense - baseline.Defense,
+				Health:  stats.Health - baseline.Health,
+			},
+		})
+
+		if i == 0 || stats.Attack > highest.Attack {
+			highest.Attack = stats.Attack
+			comparison.Highest.Attack = *character.PublicID
+		}
+		if i == 0 || stats.Defense > highest.Defense {
+			highest.Defense = stats.Defense
+			comparison.Highest.Defense = *character.PublicID
+		}
+		if i == 0 || stats.Health > highest.Health {
+			highest.Health = stats.Health
+			comparison.Highest.Health = *character.PublicID
+		}
+	}
+	return comparison, nil
+}
+
+// AnalyzeTeam reports the element coverage, role balance and base stats of a
+// party
+func (s *CharacterService) AnalyzeTeam(ids []string) (models.TeamAnalysis, error) {
+	characters, err := s.charactersByPublicIDs(ids)
+	if err != nil {
+		return models.TeamAnalysis{}, err
+	}
+
+	analysis := models.TeamAnalysis{
+		Characters:      characters,
+		Elements:        map[string]int{},
+		MissingElements: []string{},
+		Roles:           map[string]int{},
+	}
+	for _, character := range characters {
+		analysis.Elements[character.Element]++
+		if character.Role != nil && *character.Role != "" {
+			analysis.Roles[*character.Role]++
+		} else {
+			analysis.UnassignedRoles++
+		}
+
+		stats := characterStats(character)
+		analysis.TotalStats.Attack += stats.Attack
+		analysis.TotalStats.Defense += stats.Defense
+		analysis.TotalStats.Health += stats.Health
+	}
+	for _, element := range models.CharacterElements {
+		if analysis.Elements[element] == 0 {
+			analysis.MissingElements = append(analysis.MissingElements, element)
+		}
+	}
+
+	size := float64(len(characters))
+	analysis.AverageStats = models.CharacterAverageStats{
+		Attack:  float64(analysis.TotalStats.Attack) / size,
+		Defense: float64(analysis.TotalStats.Defense) / size,
+		Health:  float64(analysis.TotalStats.Health) / size,
+	}
+	return analysis, nil
+}
+
+// charactersByPublicIDs returns the characters in the order of their public
+// IDs, failing with ErrCharacterNotFound when one of them does not exist
+func (s *CharacterService) charactersByPublicIDs(publicIDs []string) ([]models.Character, error) {
+	ids := make([]int, 0, len(publicIDs))
+	seen := map[int]bool{}
+	for _, publicID := range publicIDs {
+		id, err := parseCharacterID(publicID)
+		if err != nil {
+			return nil, err
+		}
+		if seen[id] {
+			return nil, ErrDuplicateCharacterID
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	found, err := s.repo.GetCharactersByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]models.Character{}
+	for _, character := range found {
+		if character.ID != nil {
+			byID[*character.ID] = character
+		}
+	}
+
+	characters := make([]models.Character, 0, len(ids))
+	for _, id := range ids {
+		character, ok := byID[id]
+		if !ok {
+			return nil, repositories.ErrCharacterNotFound
+		}
+		if character, err = withPublicID(character); err != nil {
+			return nil, err
+		}
+		characters = append(characters, character)
+	}
+	return characters, nil
+}
+
+func characterStats(character models.Character) models.CharacterStats {
+	return models.CharacterStats{
+		Attack:  character.BaseAttack,
+		Defense: character.BaseDefense,
+		Health:  character.BaseHealth,
+	}
+}
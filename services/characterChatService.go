@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultCharacterPrompt is used when no template is stored for the character,
+// its element or the default scope
+const defaultCharacterPrompt = `You are {{.Name}}, a {{.Element}} character of rarity {{.Rarity}} who fights with a {{.WeaponType}}.
+{{- if .Role}} Your role in a party is {{.Role}}.{{end}}
+{{- if .Description}}
+About you: {{.Description}}{{end}}
+Your base stats are ATK {{.BaseAttack}}, DEF {{.BaseDefense}} and HP {{.BaseHealth}}.
+Stay in character at all times, answer in the first person and keep your replies short and conversational.`
+
+// CharacterPromptData is the data available to character prompt templates
+type CharacterPromptData struct {
+	Name        string
+	Element     string
+	WeaponType  string
+	Rarity      string
+	Role        string
+	Description string
+	ReleaseDate string
+	BaseAttack  int
+	BaseDefense int
+	BaseHealth  int
+}
+
+// ChatWithCharacter sends a message to the character identified by id within
+// the user's conversation with that character. The reply is streamed through
+// onDelta when it is not nil.
+func (s *CharacterService) ChatWithCharacter(ctx context.Context, userID primitive.ObjectID, id string, provider LLMProvider, newMessage string, onDelta func(delta string) error) (*models.ChatReply, error) {
+	characterID, err := parseCharacterID(id)
+	if err != nil {
+		return nil, err
+	}
+	character, err := s.repo.GetCharacterByID(characterID)
+	if err != nil {
+		return nil, err
+	}
+	if character.ID == nil {
+		return nil, repositories.ErrCharacterNotFound
+	}
+
+	systemPrompt, err := buildCharacterPrompt(character)
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, isNew, err := findOrNewCharacterConversation(userID, character)
+	if err != nil {
+		return nil, err
+	}
+
+	return runDialog(ctx, provider, conversation, isNew, systemPrompt, newMessage, onDelta)
+}
+
+// GetCharacterChat returns the user's conversation with the character, or an
+// empty conversation when they have not talked yet
+func (s *CharacterService) GetCharacterChat(userID primitive.ObjectID, id string) (models.ConversationDetail, error) {
+	characterID, err := parseCharacterID(id)
+	if err != nil {
+		return models.ConversationDetail{}, err
+	}
+	character, err := s.repo.GetCharacterByID(characterID)
+	if err != nil {
+		return models.ConversationDetail{}, err
+	}
+	if character.ID == nil {
+		return models.ConversationDetail{}, repositories.ErrCharacterNotFound
+	}
+
+	conversation, err := repositories.GetCharacterConversation(userID, *character.ID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.ConversationDetail{
+				Conversation: models.Conversation{UserID: userID, Title: character.Name},
+				Messages:     []models.ConversationMessage{},
+			}, nil
+		}
+		return models.ConversationDetail{}, err
+	}
+
+	messages, err := repositories.GetConversationMessages(conversation.ID, 0)
+	if err != nil {
+		return models.ConversationDetail{}, err
+	}
+
+	return models.ConversationDetail{
+		Conversation: conversation,
+		Messages:     messages,
+	}, nil
+}
+
+// buildCharacterPrompt renders the most specific template available for the
+// character: its own, then its element's, then the default one
+func buildCharacterPrompt(character models.Character) (string, error) {
+	text, err := findCharacterPromptTemplate(character)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New("character").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	data := CharacterPromptData{
+		Name:        character.Name,
+		Element:     character.Element,
+		WeaponType:  character.WeaponType,
+		Rarity:      character.Rarity,
+		ReleaseDate: character.ReleaseDate,
+		BaseAttack:  character.BaseAttack,
+		BaseDefense: character.BaseDefense,
+		BaseHealth:  character.BaseHealth,
+	}
+	if character.Role != nil {
+		data.Role = *character.Role
+	}
+	if character.Description != nil {
+		data.Description = *character.Description
+	}
+
+	var prompt bytes.Buffer
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(prompt.String()), nil
+}
+
+func findCharacterPromptTemplate(character models.Character) (string, error) {
+	lookups := []struct {
+		scope string
+		key   string
+	}{
+		{models.PromptScopeCharacter, strconv.Itoa(*character.ID)},
+		{models.PromptScopeElement, strings.ToLower(character.Element)},
+		{models.PromptScopeDefault, ""},
+	}
+
+	for _, lookup := range lookups {
+		promptTemplate, err := repositories.GetPromptTemplate(lookup.scope, lookup.key)
+		if err == nil && promptTemplate.Template != "" {
+			return promptTemplate.Template, nil
+		}
+		if err != nil && err != mongo.ErrNoDocuments {
+			return "", err
+		}
+	}
+	return defaultCharacterPrompt, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// characterIDTag fills the second half of the encrypted block. Any change to
+// a public ID scrambles the whole block, so a decoded block that does not end
+// with the tag was tampered with or forged.
+var characterIDTag = []byte("porty:ch")
+
+var characterIDEncoding = base64.RawURLEncoding
+
+// characterIDKey is an entry of CHARACTER_ID_KEYS, a base64 encoded 16, 24 or
+// 32 byte AES key named by a kid between 0 and 255
+type characterIDKey struct {
+	Kid int    `json:"kid"`
+	Key string `json:"key"`
+}
+
+type characterIDCipher struct {
+	kid   byte
+	block cipher.Block
+}
+
+// characterIDKeys are the loaded keys, the first one encodes
+var characterIDKeys []characterIDCipher
+
+// LoadCharacterIDKeys loads the keys of the public character IDs from
+// CHARACTER_ID_KEYS, a JSON array of keys. The first key encodes the IDs and
+// every key decodes them, so a rotation adds the new key first and keeps the
+// old one until the links using it no longer matter. Without keys, a key is
+// derived from ENCRYPT_KEY.
+func LoadCharacterIDKeys() error {
+	var configs []characterIDKey
+	if value := os.Getenv("CHARACTER_ID_KEYS"); value != "" {
+		if err := json.Unmarshal([]byte(value), &configs); err != nil {
+			return fmt.Errorf("invalid CHARACTER_ID_KEYS: %w", err)
+		}
+	}
+
+	var keys []characterIDCipher
+	seen := map[int]bool{}
+	for _, config := range configs {
+		if config.Kid < 0 || config.Kid > 255 {
+			return fmt.Errorf("character id key %d: kid must be between 0 and 255", config.Kid)
+		}
+		if seen[config.Kid] {
+			return fmt.Errorf("character id key %d is configured twice", config.Kid)
+		}
+		seen[config.Kid] = true
+
+		secret, err := base64.StdEncoding.DecodeString(config.Key)
+		if err != nil {
+			return fmt.Errorf("character id key %d: %w", config.Kid, err)
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return fmt.Errorf("character id key %d: %w", config.Kid, err)
+		}
+		keys = append(keys, characterIDCipher{kid: byte(config.Kid), block: block})
+	}
+
+	if len(keys) == 0 {
+		secret := os.Getenv("ENCRYPT_KEY")
+		if secret == "" {
+			return errors.New("CHARACTER_ID_KEYS or ENCRYPT_KEY must be set")
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("character public ids"))
+		block, err := aes.NewCipher(mac.Sum(nil))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, characterIDCipher{kid: 0, block: block})
+		log.Println("No character id keys configured, deriving one from ENCRYPT_KEY")
+	}
+
+	characterIDKeys = keys
+	return nil
+}
+
+// EncodeCharacterID returns the public ID of the character: the kid followed
+// by the ID and the tag encrypted as a single AES block, in URL-safe base64.
+// The same ID always gives the same public ID with a given key.
+func EncodeCharacterID(id int) (string, error) {
+	if len(characterIDKeys) == 0 {
+		return "", errors.New("character id keys are not loaded")
+	}
+	if id <= 0 {
+		return "", ErrInvalidCharacterID
+	}
+	key := characterIDKeys[0]
+
+	plain := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(plain, uint64(id))
+	copy(plain[8:], characterIDTag)
+
+	raw := make([]byte, 1+aes.BlockSize)
+	raw[0] = key.kid
+	key.block.Encrypt(raw[1:], plain)
+	return characterIDEncoding.EncodeToString(raw), nil
+}
+
+// DecodeCharacterID returns the ID behind a public ID. Malformed, forged and
+// tampered IDs, and IDs of unknown keys, fail with ErrInvalidCharacterID.
+func DecodeCharacterID(publicID string) (int, error) {
+	raw, err := characterIDEncoding.DecodeString(publicID)
+	if err != nil || len(raw) != 1+aes.BlockSize {
+		return 0, ErrInvalidCharacterID
+	}
+
+	for _, key := range characterIDKeys {
+		if key.kid != raw[0] {
+			continue
+		}
+		plain := make([]byte, aes.BlockSize)
+		key.block.Decrypt(plain, raw[1:])
+		if !bytes.Equal(plain[8:], characterIDTag) {
+			return 0, ErrInvalidCharacterID
+		}
+		id := int(binary.BigEndian.Uint64(plain))
+		if id <= 0 {
+			return 0, ErrInvalidCharacterID
+		}
+		return id, nil
+	}
+	return 0, ErrInvalidCharacterID
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+// loadCharacterIDKeys loads keys named by kid, the first one encodes
+func loadCharacterIDKeys(t *testing.T, keys ...characterIDKey) {
+	t.Helper()
+	value, err := json.Marshal(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CHARACTER_ID_KEYS", string(value))
+	if err := LoadCharacterIDKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func encodeCharacterID(t *testing.T, id int) string {
+	t.Helper()
+	publicID, err := EncodeCharacterID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicID
+}
+
+// changeCharacterID decodes the public ID, changes the raw bytes and encodes
+// them again
+func changeCharacterID(publicID string, change func(raw []byte)) string {
+	raw, _ := characterIDEncoding.DecodeString(publicID)
+	change(raw)
+	return characterIDEncoding.EncodeToString(raw)
+}
+
+func TestCharacterIDs(t *testing.T) {
+	oldKey := characterIDKey{Kid: 1, Key: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 16))}
+	newKey := characterIDKey{Kid: 2, Key: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))}
+
+	loadCharacterIDKeys(t, oldKey)
+	beforeRotation := encodeCharacterID(t, 42)
+
+	loadCharacterIDKeys(t, newKey, oldKey)
+	publicID := encodeCharacterID(t, 42)
+	if again := encodeCharacterID(t, 42); again != publicID {
+		t.Errorf("EncodeCharacterID(42) = %q then %q, want the same public ID", publicID, again)
+	}
+	if publicID == beforeRotation {
+		t.Errorf("EncodeCharacterID(42) = %q with both keys, want the new key to encode", publicID)
+	}
+
+	tests := []struct {
+		name     string
+		publicID string
+		want     int
+	}{
+		{"round trip", publicID, 42},
+		{"smallest id", encodeCharacterID(t, 1), 1},
+		{"largest id", encodeCharacterID(t, math.MaxInt64), math.MaxInt64},
+		{"old key after rotation", beforeRotation, 42},
+		{"flipped byte", changeCharacterID(publicID, func(raw []byte) { raw[5] ^= 1 }), 0},
+		{"flipped last byte", changeCharacterID(publicID, func(raw []byte) { raw[len(raw)-1] ^= 0x80 }), 0},
+		{"unknown kid", changeCharacterID(publicID, func(raw []byte) { raw[0] = 9 }), 0},
+		{"old id under the new kid", changeCharacterID(beforeRotation, func(raw []byte) { raw[0] = 2 }), 0},
+		{"truncated", publicID[:len(publicID)-2], 0},
+		{"not base64", "not a public id!", 0},
+		{"empty", "", 0},
+	}
+	for _, test := range tests {
+		got, err := DecodeCharacterID(test.publicID)
+		if test.want == 0 {
+			if !errors.Is(err, ErrInvalidCharacterID) {
+				t.Errorf("%s: DecodeCharacterID(%q) = %d, %v, want ErrInvalidCharacterID", test.name, test.publicID, got, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: DecodeCharacterID(%q) = %d, %v, want %d", test.name, test.publicID, got, err, test.want)
+		}
+	}
+
+	if _, err := EncodeCharacterID(0); !errors.Is(err, ErrInvalidCharacterID) {
+		t.Errorf("EncodeCharacterID(0) error = %v, want ErrInvalidCharacterID", err)
+	}
+}
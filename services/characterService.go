@@ -1,13 +1,27 @@
 package services
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"porty-go/models"
 	"porty-go/repositories"
-	"porty-go/utils"
+	"strings"
 )
 
+const defaultCharacterPageSize = 10
+
+var (
+	ErrInvalidCharacterID    = errors.New("invalid character id")
+	ErrEmptyCharacterPatch   = errors.New("no character field to update")
+	ErrInvalidCharacterQuery = errors.New("invalid character query")
+)
+
+// characterSortColumns are the columns the list can be sorted by
+var characterSortColumns = map[string]bool{
+	"id": true, "name": true, "element": true, "weapon_type": true, "rarity": true, "role": true,
+	"release_date": true, "base_attack": true, "base_defense": true, "base_health": true,
+}
+
 type CharacterService struct {
 	repo *repositories.CharacterRepository
 }
@@ -16,21 +30,222 @@ func NewCharacterService(repo *repositories.CharacterRepository) *CharacterServi
 	return &CharacterService{repo: repo}
 }
 
-func (s *CharacterService) ListAllCharacters(page, record int, search string) ([]models.Character, error) {
-	return s.repo.GetAllCharacters(page, record, search)
+// ListCharacters validates the query and returns the page it asks for. The
+// list is sorted by name unless asked otherwise and always by id last so
+// pages are stable.
+func (s *CharacterService) ListCharacters(query models.CharacterListQuery) (models.CharacterPage, error) {
+	filter, err := characterFilter(query)
+	if err != nil {
+		return models.CharacterPage{}, err
+	}
+
+	characters, total, err := s.repo.ListCharacters(filter)
+	if err != nil {
+		return models.CharacterPage{}, err
+	}
+	for i := range characters {
+		if characters[i], err = withPublicID(characters[i]); err != nil {
+			return models.CharacterPage{}, err
+		}
+	}
+
+	return models.CharacterPage{
+		Items:      characters,
+		Total:      total,
+		Page:       query.Page,
+		PageSize:   filter.Limit,
+		TotalPages: int((total + int64(filter.Limit) - 1) / int64(filter.Limit)),
+	}, nil
 }
 
+func characterFilter(query models.CharacterListQuery) (models.CharacterFilter, error) {
+	pageSize := query.PageSize
+	if pageSize == 0 {
+		pageSize = query.Record
+	}
+	if pageSize == 0 {
+		pageSize = defaultCharacterPageSize
+	}
+
+	filter := models.CharacterFilter{
+		Offset:       (query.Page - 1) * pageSize,
+		Limit:        pageSize,
+		Search:       strings.TrimSpace(query.Search),
+		ReleasedFrom: query.ReleasedFrom,
+		ReleasedTo:   query.ReleasedTo,
+	}
+	if filter.ReleasedFrom != "" && filter.ReleasedTo != "" && filter.ReleasedFrom > filter.ReleasedTo {
+		return models.CharacterFilter{}, fmt.Errorf("%w: released_from is after released_to", ErrInvalidCharacterQuery)
+	}
+
+	var err error
+	if filter.Elements, err = enumFilter("element", query.Element, models.CharacterElements); err != nil {
+		return models.CharacterFilter{}, err
+	}
+	if filter.WeaponTypes, err = enumFilter("weapon_type", query.WeaponType, models.CharacterWeaponTypes); err != nil {
+		return models.CharacterFilter{}, err
+	}
+	if filter.Rarities, err = enumFilter("rarity", query.Rarity, models.CharacterRarities); err != nil {
+		return models.CharacterFilter{}, err
+	}
+	filter.Roles = splitListParam(query.Role)
+
+	for _, statRange := range []models.CharacterStatRange{
+		{Column: "base_attack", Min: query.MinAttack, Max: query.MaxAttack},
+		{Column: "base_defense", Min: query.MinDefense, Max: query.MaxDefense},
+		{Column: "base_health", Min: query.MinHealth, Max: query.MaxHealth},
+	} {
+		if statRange.Min == nil && statRange.Max == nil {
+			continue
+		}
+		if statRange.Min != nil && statRange.Max != nil && *statRange.Min > *statRange.Max {
+			return models.CharacterFilter{}, fmt.Errorf("%w: the minimum %s is above the maximum", ErrInvalidCharacterQuery, statRange.Column)
+		}
+		filter.StatRanges = append(filter.StatRanges, statRange)
+	}
+
+	if filter.Sort, err = characterSort(query.Sort); err != nil {
+		return models.CharacterFilter{}, err
+	}
+	return filter, nil
+}
+
+// characterSort parses "-base_attack,name" into sort columns, falling back to
+// the name and ending with the id
+func characterSort(value string) ([]models.CharacterSort, error) {
+	var sorts []models.CharacterSort
+	seen := map[string]bool{}
+	for _, field := range splitListParam([]string{value}) {
+		sort := models.CharacterSort{Column: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+		if !characterSortColumns[sort.Column] {
+			return nil, fmt.Errorf("%w: cannot sort by %s", ErrInvalidCharacterQuery, sort.Column)
+		}
+		if seen[sort.Column] {
+			continue
+		}
+		seen[sort.Column] = true
+		sorts = append(sorts, sort)
+	}
+
+	if len(sorts) == 0 {
+		sorts = append(sorts, models.CharacterSort{Column: "name"})
+		seen["name"] = true
+	}
+	if !seen["id"] {
+		sorts = append(sorts, models.CharacterSort{Column: "id"})
+	}
+	return sorts, nil
+}
+
+// enumFilter splits the values of a list filter and checks them against the
+// allowed ones, ignoring case
+func enumFilter(name string, values, allowed []string) ([]string, error) {
+	var filtered []string
+	for _, value := range splitListParam(values) {
+		match := ""
+		for _, candidate := range allowed {
+			if strings.EqualFold(value, candidate) {
+				match = candidate
+				break
+			}
+		}
+		if match == "" {
+			return nil, fmt.Errorf("%w: %s must be one of %s", ErrInvalidCharacterQuery, name, strings.Join(allowed, ", "))
+		}
+		filtered = append(filtered, match)
+	}
+	return filtered, nil
+}
+
+// splitListParam accepts both repeated and comma-separated query values
+func splitListParam(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				split = append(split, part)
+			}
+		}
+	}
+	return split
+}
+
+// GetCharacterByID returns the character behind the public ID
 func (s *CharacterService) GetCharacterByID(id string) (models.Character, error) {
-	character, err := s.repo.GetCharacterByID(id)
+	characterID, err := parseCharacterID(id)
+	if err != nil {
+		return models.Character{}, err
+	}
+	character, err := s.repo.GetCharacterByID(characterID)
+	if err != nil {
+		return models.Character{}, err
+	}
+	return withPublicID(character)
+}
+
+// CreateCharacter stores a new character validated by the binding tags of
+// models.Character
+func (s *CharacterService) CreateCharacter(character models.Character) (models.Character, error) {
+	created, err := s.repo.CreateCharacter(character)
+	if err != nil {
+		return models.Character{}, err
+	}
+	return withPublicID(created)
+}
+
+// ReplaceCharacter overwrites every field of the character
+func (s *CharacterService) ReplaceCharacter(id string, character models.Character) (models.Character, error) {
+	characterID, err := parseCharacterID(id)
+	if err != nil {
+		return models.Character{}, err
+	}
+	updated, err := s.repo.ReplaceCharacter(characterID, character)
 	if err != nil {
 		return models.Character{}, err
 	}
-	encryptKey := os.Getenv("ENCRYPT_KEY")
-	encryptedID, err := utils.Encrypt(fmt.Sprintf("%d", *character.ID), encryptKey)
+	return withPublicID(updated)
+}
+
+// UpdateCharacter changes the fields present in the patch
+func (s *CharacterService) UpdateCharacter(id string, patch models.CharacterPatch) (models.Character, error) {
+	characterID, err := parseCharacterID(id)
+	if err != nil {
+		return models.Character{}, err
+	}
+	if patch.IsEmpty() {
+		return models.Character{}, ErrEmptyCharacterPatch
+	}
+	updated, err := s.repo.UpdateCharacter(characterID, patch)
+	if err != nil {
+		return models.Character{}, err
+	}
+	return withPublicID(updated)
+}
+
+func (s *CharacterService) DeleteCharacter(id string) error {
+	characterID, err := parseCharacterID(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.DeleteCharacter(characterID)
+	return err
+}
+
+// parseCharacterID decodes the public ID the routes take
+func parseCharacterID(id string) (int, error) {
+	return DecodeCharacterID(id)
+}
+
+// withPublicID replaces the numeric ID of the character with its public ID
+func withPublicID(character models.Character) (models.Character, error) {
+	if character.ID == nil {
+		return models.Character{}, repositories.ErrCharacterNotFound
+	}
+	publicID, err := EncodeCharacterID(*character.ID)
 	if err != nil {
 		return models.Character{}, err
 	}
 	character.ID = nil
-	character.EncryptedID = &encryptedID
+	character.PublicID = &publicID
 	return character, nil
 }
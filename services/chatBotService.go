@@ -1,120 +1,97 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
-	"net/http"
+	"context"
+	"log"
 	"porty-go/models"
 	"porty-go/repositories"
 
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Message represents a single message entry
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// GetServiceDialogFlow sends a new message within a conversation of the user,
+// replaying the stored history so the bot keeps the context of previous turns.
+// An empty conversationID starts a new conversation.
+func GetServiceDialogFlow(ctx context.Context, userID primitive.ObjectID, conversationID string, provider LLMProvider, newMessage string) (*models.ChatReply, error) {
+	return StreamServiceDialogFlow(ctx, userID, conversationID, provider, newMessage, nil)
 }
 
-// MessagesContainer holds an array of messages
-type MessagesContainer struct {
-	Messages []Message `json:"messages"`
-	Model    string    `json:"model"`
-}
-
-type BotResponse struct {
-	ID                string `json:"id"`
-	Object            string `json:"object"`
-	Created           int64  `json:"created"`
-	Model             string `json:"model"`
-	SystemFingerprint string `json:"system_fingerprint"`
-	Usage             struct {
-		CompletionTokens int `json:"completion_tokens"`
-		PromptTokens     int `json:"prompt_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
-	Choices []struct {
-		FinishReason string `json:"finish_reason"`
-		Index        int    `json:"index"`
-		Message      struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-}
-
-func GetServiceOpenAi() (models.IntegrationService, error) {
-	serviceData, err := repositories.GetIntegrationServiceByName("OPENAI")
+// StreamServiceDialogFlow behaves like GetServiceDialogFlow but requests a
+// streamed completion and calls onDelta for every content chunk received. The
+// assembled message is persisted once the upstream stream is finished.
+func StreamServiceDialogFlow(ctx context.Context, userID primitive.ObjectID, conversationID string, provider LLMProvider, newMessage string, onDelta func(delta string) error) (*models.ChatReply, error) {
+	conversation, isNew, err := findOrNewConversation(userID, conversationID, newMessage)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return models.IntegrationService{}, errors.New("service not found")
-		}
-		return models.IntegrationService{}, err
+		return nil, err
 	}
 
-	return serviceData, nil
+	return runDialog(ctx, provider, conversation, isNew, "", newMessage, onDelta)
 }
 
-func GetServiceDialogFlow(idUser int, botService models.IntegrationService, newMessage string) (*string, error) {
-	var logMessage []string // GET HISTORY DATA FROM DATABASE
-	data := MessagesContainer{
-		Messages: []Message{},
-		Model:    botService.Model,
-	}
-
-	if len(logMessage) == 0 {
-		for i := 1; i <= 2; i++ {
-			var role = "system"
-			if i%2 != 0 {
-				role = "user"
-			}
-			data.Messages = append(data.Messages, Message{
-				Role:    role,
-				Content: newMessage,
-			})
-		}
+// runDialog sends the system prompt, the conversation history and the new
+// message to the provider and stores the turn along with its token usage. The
+// completion is streamed when onDelta is not nil. A new conversation is only
+// stored with its first turn, so refused and failed dialogs leave none behind.
+func runDialog(ctx context.Context, provider LLMProvider, conversation models.Conversation, isNew bool, systemPrompt, newMessage string, onDelta func(delta string) error) (*models.ChatReply, error) {
+	if err := CheckQuota(conversation.UserID); err != nil {
+		return nil, err
 	}
 
-	jsonData, err := json.Marshal(data)
+	messages, err := buildDialogMessages(conversation, isNew, systemPrompt, newMessage)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", botService.ServiceUrl, bytes.NewBuffer(jsonData))
+	var completion *ChatCompletion
+	if onDelta != nil {
+		completion, err = provider.Stream(ctx, messages, onDelta)
+	} else {
+		completion, err = provider.Complete(ctx, messages)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", botService.Token)) // Replace with actual token
+	if err := RecordUsage(conversation, completion); err != nil {
+		log.Println("Error recording token usage:", err)
+	}
 
-	// Make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	if err := saveConversationTurn(conversation, isNew, newMessage, completion.Content); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("Error reading response:", err)
-		return nil, err
+	return &models.ChatReply{
+		ConversationID: conversation.ID.Hex(),
+		Message:        completion.Content,
+	}, nil
+}
+
+func buildDialogMessages(conversation models.Conversation, isNew bool, systemPrompt, newMessage string) ([]Message, error) {
+	var history []models.ConversationMessage
+	if !isNew {
+		var err error
+		if history, err = repositories.GetConversationMessages(conversation.ID, chatHistoryLimit); err != nil {
+			return nil, err
+		}
 	}
 
-	// Unmarshal response into struct
-	var botResp BotResponse
-	err = json.Unmarshal(body, &botResp)
-	if err != nil {
-		fmt.Println("Error unmarshalling response:", err)
-		return nil, err
+	messages := []Message{}
+	if systemPrompt != "" {
+		messages = append(messages, Message{
+			Role:    "system",
+			Content: systemPrompt,
+		})
+	}
+	for _, message := range history {
+		messages = append(messages, Message{
+			Role:    message.Role,
+			Content: message.Content,
+		})
 	}
+	messages = append(messages, Message{
+		Role:    "user",
+		Content: newMessage,
+	})
 
-	content := botResp.Choices[0].Message.Content
-	return &content, nil
+	return messages, nil
 }
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// chatHistoryLimit bounds how many previous messages are replayed to the bot
+const chatHistoryLimit = 20
+
+const conversationTitleLength = 50
+
+var ErrConversationNotFound = errors.New("conversation not found")
+
+func ListConversations(userID primitive.ObjectID) ([]models.Conversation, error) {
+	return repositories.ListConversationsByUser(userID)
+}
+
+func GetConversation(userID primitive.ObjectID, id string) (models.ConversationDetail, error) {
+	conversation, err := findConversation(userID, id)
+	if err != nil {
+		return models.ConversationDetail{}, err
+	}
+
+	messages, err := repositories.GetConversationMessages(conversation.ID, 0)
+	if err != nil {
+		return models.ConversationDetail{}, err
+	}
+
+	return models.ConversationDetail{
+		Conversation: conversation,
+		Messages:     messages,
+	}, nil
+}
+
+func RenameConversation(userID primitive.ObjectID, id, title string) (models.Conversation, error) {
+	conversation, err := findConversation(userID, id)
+	if err != nil {
+		return models.Conversation{}, err
+	}
+
+	if _, err := repositories.UpdateConversationTitle(conversation.ID, userID, title); err != nil {
+		return models.Conversation{}, err
+	}
+
+	now := time.Now()
+	conversation.Title = title
+	conversation.UpdatedAt = &now
+	return conversation, nil
+}
+
+func DeleteConversation(userID primitive.ObjectID, id string) error {
+	conversation, err := findConversation(userID, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = repositories.DeleteConversation(conversation.ID, userID)
+	return err
+}
+
+func findConversation(userID primitive.ObjectID, id string) (models.Conversation, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Conversation{}, ErrConversationNotFound
+	}
+
+	conversation, err := repositories.GetConversationByID(objID, userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Conversation{}, ErrConversationNotFound
+		}
+		return models.Conversation{}, err
+	}
+	return conversation, nil
+}
+
+// findOrNewConversation returns the conversation of the user with the id, or
+// a new one when id is empty. New conversations are not stored yet, reported
+// by isNew, so a dialog that fails leaves nothing behind.
+func findOrNewConversation(userID primitive.ObjectID, id, firstMessage string) (conversation models.Conversation, isNew bool, err error) {
+	if id != "" {
+		conversation, err := findConversation(userID, id)
+		if err != nil {
+			return models.Conversation{}, false, err
+		}
+		// Character conversations can only be continued through their character
+		if conversation.CharacterID != nil {
+			return models.Conversation{}, false, ErrConversationNotFound
+		}
+		return conversation, false, nil
+	}
+
+	return models.Conversation{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Title:     conversationTitle(firstMessage),
+		CreatedAt: time.Now(),
+		UpdatedAt: nil,
+	}, true, nil
+}
+
+// findOrNewCharacterConversation returns the conversation of the user with the
+// character, or a new one that is not stored yet as in findOrNewConversation
+func findOrNewCharacterConversation(userID primitive.ObjectID, character models.Character) (models.Conversation, bool, error) {
+	conversation, err := repositories.GetCharacterConversation(userID, *character.ID)
+	if err == nil {
+		return conversation, false, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return models.Conversation{}, false, err
+	}
+
+	conversation = models.Conversation{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		Title:       character.Name,
+		CharacterID: character.ID,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   nil,
+	}
+	return conversation, true, nil
+}
+
+// saveConversationTurn stores the user message and the bot reply of one turn,
+// storing the conversation first when it is new
+func saveConversationTurn(conversation models.Conversation, isNew bool, userMessage, botMessage string) error {
+	if isNew {
+		if _, err := repositories.CreateConversation(conversation); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	messages := []models.ConversationMessage{
+		{
+			ID:             primitive.NewObjectID(),
+			ConversationID: conversation.ID,
+			UserID:         conversation.UserID,
+			Role:           "user",
+			Content:        userMessage,
+			CreatedAt:      now,
+		},
+		{
+			ID:             primitive.NewObjectID(),
+			ConversationID: conversation.ID,
+			UserID:         conversation.UserID,
+			Role:           "assistant",
+			Content:        botMessage,
+			CreatedAt:      now.Add(time.Millisecond),
+		},
+	}
+	if _, err := repositories.CreateConversationMessages(messages); err != nil {
+		return err
+	}
+
+	_, err := repositories.TouchConversation(conversation.ID)
+	return err
+}
+
+func conversationTitle(message string) string {
+	title := strings.Join(strings.Fields(message), " ")
+	runes := []rune(title)
+	if len(runes) > conversationTitleLength {
+		return string(runes[:conversationTitleLength]) + "..."
+	}
+	return title
+}
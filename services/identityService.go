@@ -0,0 +1,214 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"porty-go/models"
+	"porty-go/repositories"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// reauthMaxAge is how recent the login of a passwordless account must be for
+// sensitive changes
+const reauthMaxAge = 5 * time.Minute
+
+var (
+	ErrReauthRequired        = errors.New("please log in again to continue")
+	ErrOAuthAccountExists    = errors.New("an account with this email already exists, log in and link the provider from your account")
+	ErrIdentityInUse         = errors.New("this provider account is linked to another user")
+	ErrProviderAlreadyLinked = errors.New("another account of this provider is already linked")
+	ErrIdentityNotLinked     = errors.New("no account of this provider is linked")
+	ErrLastLoginMethod       = errors.New("cannot unlink the last login method, set a password first")
+)
+
+// Reauthenticate confirms the user before a sensitive change: accounts with a
+// password must give it, throttled like logins, passwordless ones must have
+// logged in within reauthMaxAge to start the session of the access token
+func Reauthenticate(user models.User, accessTokenID, password, ip, userAgent string) error {
+	if user.Password != "" {
+		return verifyUserPassword(user, password, ip, userAgent)
+	}
+
+	session, err := repositories.GetRefreshTokenByAccessID(accessTokenID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrReauthRequired
+		}
+		return err
+	}
+	if session.UserID != user.ID || time.Since(session.AuthTime) > reauthMaxAge {
+		return ErrReauthRequired
+	}
+	return nil
+}
+
+// StartIdentityLink re-authenticates the user and returns the path of the
+// provider login that links the provider account to the user. The path
+// carries a single-use link code and is meant to be opened in the browser.
+func StartIdentityLink(userID primitive.ObjectID, accessTokenID, provider, password, redirectTo, ip, userAgent string) (string, error) {
+	redirectTo, err := ValidateRedirect(redirectTo)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		return "", err
+	}
+	if err := Reauthenticate(user, accessTokenID, password, ip, userAgent); err != nil {
+		return "", err
+	}
+
+	code, err := createLoginCode(user.ID, models.LoginCodePurposeLink, nil)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{"link": {code}}
+	if redirectTo != "" {
+		query.Set("redirect_to", redirectTo)
+	}
+	return "/auth/" + url.PathEscape(provider) + "/login?" + query.Encode(), nil
+}
+
+// UseLinkCode consumes a link code, returning the user to link to
+func UseLinkCode(code string) (primitive.ObjectID, error) {
+	linkCode, err := repositories.UseLoginCode(hashToken(code), models.LoginCodePurposeLink)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrInvalidLoginCode
+		}
+		return primitive.NilObjectID, err
+	}
+	return linkCode.UserID, nil
+}
+
+// CreateLinkConfirmCode holds the provider account logged in to from a link
+// started by the user until the user confirms it with ConfirmIdentityLink.
+// The browser that finished the provider login may not be the user's, so the
+// link is only made once the user is authenticated again.
+func CreateLinkConfirmCode(userID primitive.ObjectID, identity OAuthIdentity) (string, error) {
+	return createLoginCode(userID, models.LoginCodePurposeLinkConfirm, &models.LinkedIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+}
+
+// ConfirmIdentityLink consumes a link confirmation code and links its
+// provider account to the user, who must be the one who started the link. It
+// returns the provider linked.
+func ConfirmIdentityLink(userID primitive.ObjectID, code string) (string, error) {
+	linkCode, err := repositories.UseLoginCode(hashToken(code), models.LoginCodePurposeLinkConfirm)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", ErrInvalidLoginCode
+		}
+		return "", err
+	}
+	if linkCode.UserID != userID || linkCode.Identity == nil {
+		return "", ErrInvalidLoginCode
+	}
+
+	identity := OAuthIdentity{
+		Provider: linkCode.Identity.Provider,
+		Subject:  linkCode.Identity.Subject,
+		Email:    linkCode.Identity.Email,
+	}
+	if err := LinkIdentity(userID, identity); err != nil {
+		return "", err
+	}
+	return identity.Provider, nil
+}
+
+// LinkIdentity links the provider account to the user. Each user can have one
+// account per provider and each provider account belongs to one user.
+func LinkIdentity(userID primitive.ObjectID, identity OAuthIdentity) error {
+	owner, err := repositories.GetUserByIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		if owner.ID == userID {
+			return nil
+		}
+		return ErrIdentityInUse
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	return addIdentity(userID, identity)
+}
+
+// UnlinkIdentity removes the account of the provider from the user, unless it
+// is the only way left to log in
+func UnlinkIdentity(userID primitive.ObjectID, provider string) error {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+
+	linked := false
+	for _, identity := range user.Identities {
+		if identity.Provider == provider {
+			linked = true
+		}
+	}
+	if !linked {
+		return ErrIdentityNotLinked
+	}
+
+	loginMethods := len(user.Identities)
+	if user.Password != "" {
+		loginMethods++
+	}
+	if loginMethods <= 1 {
+		return ErrLastLoginMethod
+	}
+
+	fields := bson.M{}
+	if provider == OAuthProviderGoogle {
+		fields["isGoogle"] = false
+	}
+	_, err = repositories.RemoveUserIdentity(userID, provider, fields)
+	return err
+}
+
+func ListIdentities(userID primitive.ObjectID) ([]models.LinkedIdentity, error) {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Identities == nil {
+		return []models.LinkedIdentity{}, nil
+	}
+	return user.Identities, nil
+}
+
+func addIdentity(userID primitive.ObjectID, identity OAuthIdentity) error {
+	linked := models.LinkedIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: time.Now(),
+	}
+
+	fields := bson.M{}
+	if identity.Provider == OAuthProviderGoogle {
+		fields["isGoogle"] = true
+	}
+
+	result, err := repositories.AddUserIdentity(userID, linked, fields)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrIdentityInUse
+		}
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrProviderAlreadyLinked
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"porty-go/models"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSAKeyBits = 2048
+
+var (
+	ErrSigningKeysNotLoaded = errors.New("token signing keys are not loaded")
+	ErrNoActiveSigningKey   = errors.New("no token signing key is active")
+	ErrUnknownSigningKey    = errors.New("token is signed with an unknown key")
+)
+
+// jwtKeyConfig is an entry of JWT_KEYS or JWT_KEYS_FILE. The PEM is given
+// inline in key or read from keyFile. Private keys sign tokens from
+// activeFrom on, public keys only verify them. Tokens of a key stop
+// validating at retireAt.
+type jwtKeyConfig struct {
+	Kid        string    `json:"kid"`
+	Alg        string    `json:"alg"`
+	Key        string    `json:"key"`
+	KeyFile    string    `json:"keyFile"`
+	ActiveFrom time.Time `json:"activeFrom"`
+	RetireAt   time.Time `json:"retireAt"`
+}
+
+// signingKey is a key of the keyring. Legacy HS256 keys have no ID and
+// verify the tokens issued before kids were introduced.
+type signingKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	SignKey    interface{}
+	VerifyKey  interface{}
+	ActiveFrom time.Time
+	RetireAt   time.Time
+}
+
+func (k *signingKey) canSign(now time.Time) bool {
+	return k.SignKey != nil && !k.ActiveFrom.After(now) && !k.retired(now)
+}
+
+func (k *signingKey) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+type keyRing struct {
+	keys   []*signingKey
+	legacy *signingKey
+}
+
+var tokenKeys *keyRing
+
+// LoadSigningKeys loads the token signing keys from JWT_KEYS, a JSON array of
+// keys, or the JSON file at JWT_KEYS_FILE. The key with the latest activeFrom
+// that is active signs, so rotations are scheduled by adding the next key
+// ahead of time. Without keys, tokens are signed with HS256 and JWT_SECRET;
+// with keys, JWT_SECRET only verifies the tokens signed before the switch and
+// should be unset once they have expired.
+func LoadSigningKeys() error {
+	configs, err := readJWTKeyConfigs()
+	if err != nil {
+		return err
+	}
+
+	ring := &keyRing{}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		ring.legacy = &signingKey{
+			Method:    jwt.SigningMethodHS256,
+			SignKey:   []byte(secret),
+			VerifyKey: []byte(secret),
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, config := range configs {
+		key, err := parseJWTKeyConfig(config)
+		if err != nil {
+			return fmt.Errorf("jwt key %q: %w", config.Kid, err)
+		}
+		if seen[key.ID] {
+			return fmt.Errorf("jwt key %q is configured twice", key.ID)
+		}
+		seen[key.ID] = true
+		ring.keys = append(ring.keys, key)
+	}
+
+	// Latest activation first, the first key that can sign is the active one
+	sort.SliceStable(ring.keys, func(i, j int) bool {
+		return ring.keys[i].ActiveFrom.After(ring.keys[j].ActiveFrom)
+	})
+
+	switch {
+	case len(ring.keys) > 0:
+		if _, err := ring.signer(time.Now()); err != nil {
+			return err
+		}
+		if ring.legacy != nil {
+			log.Println("JWT_SECRET is set, HS256 tokens without a kid are still accepted")
+		}
+	case ring.legacy != nil:
+		log.Println("No JWT keys configured, signing tokens with HS256 and JWT_SECRET")
+	default:
+		return errors.New("JWT_KEYS, JWT_KEYS_FILE or JWT_SECRET must be set")
+	}
+
+	tokenKeys = ring
+	return nil
+}
+
+func readJWTKeyConfigs() ([]jwtKeyConfig, error) {
+	data := []byte(os.Getenv("JWT_KEYS"))
+	if path := os.Getenv("JWT_KEYS_FILE"); len(data) == 0 && path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var configs []jwtKeyConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("invalid JWT keys: %w", err)
+	}
+	return configs, nil
+}
+
+func parseJWTKeyConfig(config jwtKeyConfig) (*signingKey, error) {
+	if config.Kid == "" {
+		return nil, errors.New("kid is required")
+	}
+	if !config.RetireAt.IsZero() && !config.RetireAt.After(config.ActiveFrom) {
+		return nil, errors.New("retireAt must be after activeFrom")
+	}
+
+	data := []byte(config.Key)
+	if len(data) == 0 && config.KeyFile != "" {
+		var err error
+		if data, err = os.ReadFile(config.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	signKey, verifyKey, err := parseKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var method jwt.SigningMethod
+	switch public := verifyKey.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys need at least %d bits", minRSAKeyBits)
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use an RSA or Ed25519 key", verifyKey)
+	}
+	if config.Alg != "" && config.Alg != method.Alg() {
+		return nil, fmt.Errorf("alg %s does not match the %s key", config.Alg, method.Alg())
+	}
+
+	return &signingKey{
+		ID:         config.Kid,
+		Method:     method,
+		SignKey:    signKey,
+		VerifyKey:  verifyKey,
+		ActiveFrom: config.ActiveFrom,
+		RetireAt:   config.RetireAt,
+	}, nil
+}
+
+// parseKeyPEM reads a PKCS#8 or PKCS#1 private key, or a PKIX public key for
+// keys that only verify. signKey is nil for public keys.
+func parseKeyPEM(data []byte) (signKey crypto.Signer, verifyKey crypto.PublicKey, err error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported private key type %T", parsed)
+		}
+		return signer, signer.Public(), nil
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return parsed, parsed.Public(), nil
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, parsed, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// signer returns the key that signs new tokens
+func (r *keyRing) signer(now time.Time) (*signingKey, error) {
+	if len(r.keys) == 0 {
+		return r.legacy, nil
+	}
+	for _, key := range r.keys {
+		if key.canSign(now) {
+			return key, nil
+		}
+	}
+	return nil, ErrNoActiveSigningKey
+}
+
+// verifier returns the key a token with the kid was signed with
+func (r *keyRing) verifier(kid string, now time.Time) (*signingKey, bool) {
+	if kid == "" {
+		return r.legacy, r.legacy != nil
+	}
+	for _, key := range r.keys {
+		if key.ID == kid {
+			return key, !key.retired(now)
+		}
+	}
+	return nil, false
+}
+
+func (r *keyRing) algorithms() []string {
+	seen := map[string]bool{}
+	var algorithms []string
+	keys := r.keys
+	if r.legacy != nil {
+		keys = append([]*signingKey{r.legacy}, keys...)
+	}
+	for _, key := range keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algorithms = append(algorithms, alg)
+		}
+	}
+	return algorithms
+}
+
+// signToken signs the claims with the active key, naming it in the kid header
+func signToken(claims jwt.Claims) (string, error) {
+	if tokenKeys == nil {
+		return "", ErrSigningKeysNotLoaded
+	}
+	key, err := tokenKeys.signer(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.SignKey)
+}
+
+// ParseToken verifies the token with the key named by its kid header and
+// decodes its claims. Expired tokens fail with jwt.ErrTokenExpired.
+func ParseToken(tokenString string, claims jwt.Claims) error {
+	if tokenKeys == nil {
+		return ErrSigningKeysNotLoaded
+	}
+
+	now := time.Now()
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := tokenKeys.verifier(kid, now)
+		if !ok {
+			return nil, ErrUnknownSigningKey
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.VerifyKey, nil
+	}, jwt.WithValidMethods(tokenKeys.algorithms()), jwt.WithExpirationRequired(), jwt.WithTimeFunc(func() time.Time {
+		return now
+	}))
+	return err
+}
+
+// JWKS returns the public keys that are not retired, including the ones
+// scheduled to sign later so verifiers know them before they are used. HS256
+// secrets are never published.
+func JWKS() models.JSONWebKeySet {
+	set := models.JSONWebKeySet{Keys: []models.JSONWebKey{}}
+	if tokenKeys == nil {
+		return set
+	}
+
+	now := time.Now()
+	for _, key := range tokenKeys.keys {
+		if key.retired(now) {
+			continue
+		}
+
+		jwk := models.JSONWebKey{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+)
+
+// defaultChatServiceName is the integrationService document used when
+// AI_SERVICE_NAME is not set
+const defaultChatServiceName = "OPENAI"
+
+// Message represents a single message entry
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// TokenUsage is the token accounting reported by a provider for one completion
+type TokenUsage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// ChatCompletion is the provider-agnostic result of a chat request
+type ChatCompletion struct {
+	Content string
+	Model   string
+	Usage   TokenUsage
+}
+
+// LLMProvider sends a list of chat messages to a language model backend
+type LLMProvider interface {
+	// Complete returns the whole reply at once
+	Complete(ctx context.Context, messages []Message) (*ChatCompletion, error)
+	// Stream calls onDelta for every chunk of the reply as it arrives and
+	// returns the assembled completion at the end
+	Stream(ctx context.Context, messages []Message, onDelta func(delta string) error) (*ChatCompletion, error)
+}
+
+// GetChatProvider builds the provider configured by the integrationService
+// document named in AI_SERVICE_NAME (OPENAI by default)
+func GetChatProvider() (LLMProvider, error) {
+	name := os.Getenv("AI_SERVICE_NAME")
+	if name == "" {
+		name = defaultChatServiceName
+	}
+
+	serviceData, err := repositories.GetIntegrationServiceByName(name)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("service not found")
+		}
+		return nil, err
+	}
+
+	return NewLLMProvider(serviceData, http.DefaultClient)
+}
+
+// NewLLMProvider selects the implementation from the Provider field of the
+// service, falling back to its ServiceName
+func NewLLMProvider(service models.IntegrationService, client *http.Client) (LLMProvider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	provider := strings.ToLower(service.Provider)
+	if provider == "" {
+		provider = strings.ToLower(service.ServiceName)
+	}
+
+	switch provider {
+	case ProviderOpenAI, "":
+		return &openAIProvider{service: service, client: client}, nil
+	case ProviderAnthropic:
+		return &anthropicProvider{service: service, client: client}, nil
+	case ProviderOllama:
+		return &ollamaProvider{service: service, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unsupported chat provider: %s", provider)
+	}
+}
+
+// postJSON sends the payload to url and returns the response when the status
+// is 2xx
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("chat service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func decodeJSONResponse(resp *http.Response, target interface{}) error {
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println("Error reading response:", err)
+		return err
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		fmt.Println("Error unmarshalling response:", err)
+		return err
+	}
+	return nil
+}
+
+// scanSSEData calls handle with the payload of every `data:` line of a
+// Server-Sent Events body until handle reports done
+func scanSSEData(body io.Reader, handle func(payload string) (done bool, err error)) error {
+	return scanLines(body, func(line string) (bool, error) {
+		if !strings.HasPrefix(line, "data:") {
+			return false, nil
+		}
+		return handle(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+	})
+}
+
+// scanLines calls handle with every non-empty line of body until handle
+// reports done
+func scanLines(body io.Reader, handle func(line string) (done bool, err error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		done, err := handle(line)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// emitDelta appends a chunk to the reply and forwards it to onDelta
+func emitDelta(content *strings.Builder, delta string, onDelta func(delta string) error) error {
+	if delta == "" {
+		return nil
+	}
+	content.WriteString(delta)
+	if onDelta != nil {
+		return onDelta(delta)
+	}
+	return nil
+}
+
+func checkCompletion(completion *ChatCompletion) (*ChatCompletion, error) {
+	if completion.Content == "" {
+		return nil, errors.New("empty response from chat service")
+	}
+	if completion.Usage.TotalTokens == 0 {
+		completion.Usage.TotalTokens = completion.Usage.PromptTokens + completion.Usage.CompletionTokens
+	}
+	return completion, nil
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	loginAttemptWindow      = 15 * time.Minute
+	maxIPLoginFailures      = 30
+	loginDelayAfterFailures = 3
+	maxLoginDelay           = time.Minute
+	defaultLockoutThreshold = 10
+	defaultLockoutDuration  = 15 * time.Minute
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrPasswordNotSet     = errors.New("this account has no password, please login with your login provider or set a password to login with email")
+)
+
+// LoginThrottledError is returned when an IP or email has failed to log in
+// too often recently
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
+
+// AccountLockedError is returned for accounts locked after repeated failures
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return "account is temporarily locked after too many failed login attempts, try again later or reset your password"
+}
+
+// loginAttempts counts failed logins, see NewAttemptStoreFromEnv
+var loginAttempts AttemptStore = NewMemoryAttemptStore()
+
+// SetAttemptStore replaces the store counting failed logins
+func SetAttemptStore(store AttemptStore) {
+	loginAttempts = store
+}
+
+// AuthenticateUser checks the email and password of a login. Failures are
+// throttled per IP and per email, with delays growing after every failure,
+// and lock the account once LOGIN_LOCKOUT_THRESHOLD is reached.
+func AuthenticateUser(email, password, ip, userAgent string) (models.User, error) {
+	if err := checkLoginThrottle(email, ip); err != nil {
+		recordAuthEvent(models.AuthEventLoginThrottled, nil, email, ip, userAgent, err.Error())
+		return models.User{}, err
+	}
+
+	user, err := GetUserByEmail(email)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return models.User{}, err
+		}
+		if err := recordLoginFailure(nil, email, ip, userAgent, "unknown email"); err != nil {
+			return models.User{}, err
+		}
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	if err := checkAccountLock(user, ip, userAgent); err != nil {
+		return models.User{}, err
+	}
+
+	if user.Password == "" {
+		return models.User{}, ErrPasswordNotSet
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		if err := recordLoginFailure(&user, email, ip, userAgent, "wrong password"); err != nil {
+			return models.User{}, err
+		}
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	// Logins with a second factor succeed once the code is checked
+	if !user.MFAEnabled() {
+		recordLoginSuccess(user, ip, userAgent)
+	}
+	return user, nil
+}
+
+// verifyUserPassword checks the password of a signed in user confirming a
+// sensitive change. Failures count towards the same throttling and lockout as
+// logins so a stolen access token cannot be used to guess the password.
+func verifyUserPassword(user models.User, password, ip, userAgent string) error {
+	if err := checkLoginThrottle(user.Email, ip); err != nil {
+		recordAuthEvent(models.AuthEventLoginThrottled, &user.ID, user.Email, ip, userAgent, err.Error())
+		return err
+	}
+	if err := checkAccountLock(user, ip, userAgent); err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		if err := recordLoginFailure(&user, user.Email, ip, userAgent, "wrong password on re-authentication"); err != nil {
+			return err
+		}
+		return ErrCurrentPasswordWrong
+	}
+
+	// Like logins, users with a second factor are only cleared by the code
+	if !user.MFAEnabled() {
+		if err := loginAttempts.Reset(emailAttemptKey(user.Email)); err != nil {
+			log.Println("Error resetting login attempts:", err)
+		}
+	}
+	return nil
+}
+
+// checkLoginThrottle refuses logins from an IP with too many recent failures
+// and logins to an email before the delay earned by its failures is over
+func checkLoginThrottle(email, ip string) error {
+	now := time.Now()
+
+	ipAttempts, err := loginAttempts.Get(ipAttemptKey(ip))
+	if err != nil {
+		return err
+	}
+	if ipAttempts.Count >= maxIPLoginFailures {
+		return &LoginThrottledError{RetryAfter: ipAttempts.ExpiresAt.Sub(now)}
+	}
+
+	emailAttempts, err := loginAttempts.Get(emailAttemptKey(email))
+	if err != nil {
+		return err
+	}
+	if wait := emailAttempts.LastAt.Add(loginDelay(emailAttempts.Count)).Sub(now); wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// checkAccountLock returns an *AccountLockedError while the user is locked
+func checkAccountLock(user models.User, ip, userAgent string) error {
+	if user.LockedUntil == nil || !user.LockedUntil.After(time.Now()) {
+		return nil
+	}
+
+	err := &AccountLockedError{Until: *user.LockedUntil}
+	recordAuthEvent(models.AuthEventLoginThrottled, &user.ID, user.Email, ip, userAgent, err.Error())
+	return err
+}
+
+// recordLoginFailure counts the failure for the IP and email and locks the
+// user once the email reaches the lockout threshold, returning an
+// *AccountLockedError in that case
+func recordLoginFailure(user *models.User, email, ip, userAgent, reason string) error {
+	var userID *primitive.ObjectID
+	if user != nil {
+		userID = &user.ID
+	}
+	recordAuthEvent(models.AuthEventLoginFailure, userID, email, ip, userAgent, reason)
+
+	if _, err := loginAttempts.Add(ipAttemptKey(ip), loginAttemptWindow); err != nil {
+		return err
+	}
+	emailAttempts, err := loginAttempts.Add(emailAttemptKey(email), loginAttemptWindow)
+	if err != nil {
+		return err
+	}
+
+	if user == nil || emailAttempts.Count < lockoutThreshold() {
+		return nil
+	}
+
+	until := time.Now().Add(durationFromEnv("LOGIN_LOCKOUT_DURATION", defaultLockoutDuration))
+	if _, err := repositories.UpdateUserFields(user.ID, bson.M{"lockedUntil": until}); err != nil {
+		return err
+	}
+	if err := loginAttempts.Reset(emailAttemptKey(email)); err != nil {
+		log.Println("Error resetting login attempts:", err)
+	}
+
+	recordAuthEvent(models.AuthEventAccountLocked, userID, email, ip, userAgent, fmt.Sprintf("%d failed attempts", emailAttempts.Count))
+	if err := SendAccountLockedEmail(user.Email, user.FullName, until); err != nil {
+		log.Println("Error sending account locked email:", err)
+	}
+	return &AccountLockedError{Until: until}
+}
+
+// recordLoginSuccess clears the failures of the email
+func recordLoginSuccess(user models.User, ip, userAgent string) {
+	if err := loginAttempts.Reset(emailAttemptKey(user.Email)); err != nil {
+		log.Println("Error resetting login attempts:", err)
+	}
+	recordAuthEvent(models.AuthEventLoginSuccess, &user.ID, user.Email, ip, userAgent, "")
+}
+
+// recordAuthEvent stores the event, failures are only logged
+func recordAuthEvent(eventType string, userID *primitive.ObjectID, email, ip, userAgent, reason string) {
+	_, err := repositories.CreateAuthEvent(models.AuthEvent{
+		ID:        primitive.NewObjectID(),
+		Type:      eventType,
+		UserID:    userID,
+		Email:     strings.ToLower(email),
+		IP:        ip,
+		UserAgent: userAgent,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Println("Error recording auth event:", err)
+	}
+}
+
+func SendAccountLockedEmail(to, name string, until time.Time) error {
+	if name == "" {
+		name = to
+	}
+
+	resetLink := GetFrontendURL() + "/auth/forgot-password"
+	data := struct {
+		Name        string
+		LockedUntil string
+		ResetLink   string
+	}{
+		Name:        name,
+		LockedUntil: until.UTC().Format("January 2, 2006 15:04 MST"),
+		ResetLink:   resetLink,
+	}
+
+	body := "Your Porty!!! account has been locked after too many failed login attempts. If this wasn't you, reset your password: " + resetLink
+	return sendTemplateEmail(to, "Your Porty!!! account has been locked", body, "templates/account_locked_email.html", data)
+}
+
+// loginDelay is how long an email has to wait after its last failure:
+// nothing for the first failures, then doubling up to maxLoginDelay
+func loginDelay(failures int) time.Duration {
+	if failures < loginDelayAfterFailures {
+		return 0
+	}
+
+	delay := time.Second
+	for i := loginDelayAfterFailures; i < failures && delay < maxLoginDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// lockoutThreshold reads LOGIN_LOCKOUT_THRESHOLD, the failures within
+// loginAttemptWindow that lock an account
+func lockoutThreshold() int {
+	threshold, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_THRESHOLD"))
+	if err != nil || threshold <= 0 {
+		return defaultLockoutThreshold
+	}
+	return threshold
+}
+
+// ipAttemptKey counts IPv6 clients by their /64, which a single host can
+// pick any address from
+func ipAttemptKey(ip string) string {
+	if addr, err := netip.ParseAddr(ip); err == nil && addr.Is6() && !addr.Is4In6() {
+		prefix, _ := addr.Prefix(64)
+		return "ip:" + prefix.String()
+	}
+	return "ip:" + ip
+}
+
+func emailAttemptKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,20 @@
+package services
+
+import "testing"
+
+func TestIPAttemptKey(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.7", "ip:203.0.113.7"},
+		{"2001:db8:1:2:aaaa::1", "ip:2001:db8:1:2::/64"},
+		{"2001:db8:1:2:ffff::9", "ip:2001:db8:1:2::/64"},
+		{"::ffff:203.0.113.7", "ip:::ffff:203.0.113.7"},
+	}
+	for _, test := range tests {
+		if got := ipAttemptKey(test.ip); got != test.want {
+			t.Errorf("ipAttemptKey(%q) = %q, want %q", test.ip, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// Email is a message ready to be delivered by a Mailer
+type Email struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// smtpTimeout bounds an SMTP delivery whose context has no deadline
+const smtpTimeout = 30 * time.Second
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// NewMailerFromEnv builds the mailer selected by MAILER: smtp (default), log
+// to write emails to MAIL_LOG_DIR (or the application log), or memory
+func NewMailerFromEnv() Mailer {
+	switch strings.ToLower(os.Getenv("MAILER")) {
+	case "log", "file":
+		return &LogMailer{Dir: os.Getenv("MAIL_LOG_DIR")}
+	case "memory":
+		return &MemoryMailer{}
+	default:
+		port, err := strconv.Atoi(os.Getenv("EMAIL_PORT"))
+		if err != nil {
+			port = 587
+		}
+		host := os.Getenv("EMAIL_HOST")
+		if host == "" {
+			host = "smtp.gmail.com"
+		}
+		return &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("EMAIL_USERNAME"),
+			Password: os.Getenv("EMAIL_PASSWORD"),
+			From:     os.Getenv("EMAIL_USERNAME"),
+		}
+	}
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, email Email) error {
+	message := gomail.NewMessage()
+	message.SetHeader("From", m.From)
+	message.SetHeader("To", email.To)
+	message.SetHeader("Subject", email.Subject)
+	message.SetBody("text/plain", email.TextBody)
+	if email.HTMLBody != "" {
+		message.AddAlternative("text/html", email.HTMLBody)
+	}
+
+	return m.deliver(ctx, message, email.To)
+}
+
+// deliver sends the message over a connection bound to ctx: the dial honours
+// its cancellation and every read and write its deadline, or smtpTimeout when
+// it has none. Port 465 uses implicit TLS, the others STARTTLS when offered.
+func (m *SMTPMailer) deliver(ctx context.Context, message *gomail.Message, to string) (err error) {
+	defer func() {
+		// Report the cancellation rather than the i/o timeout it caused
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+
+	address := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Unblock the exchange as soon as ctx is canceled
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	tlsConfig := &tls.Config{ServerName: m.Host}
+	if m.Port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && m.Port != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := message.WriteTo(writer); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	// The server accepted the message, failing to say goodbye must not get it
+	// sent again
+	client.Quit()
+	return nil
+}
+
+// LogMailer writes emails to files in Dir, or to the application log when Dir
+// is empty. It is meant for local development.
+type LogMailer struct {
+	Dir string
+}
+
+func (m *LogMailer) Send(ctx context.Context, email Email) error {
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n\n%s\n", email.To, email.Subject, email.TextBody, email.HTMLBody)
+	if m.Dir == "" {
+		log.Printf("Email to %s: %s\n%s", email.To, email.Subject, email.TextBody)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFileName(email.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0o644)
+}
+
+// MemoryMailer keeps sent emails in memory, for tests
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Email
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, email Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, email)
+	return nil
+}
+
+// Sent returns a copy of the emails sent so far
+func (m *MemoryMailer) Sent() []Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Email(nil), m.sent...)
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"porty-go/models"
+	"porty-go/repositories"
+	"porty-go/utils"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	mfaIssuer         = "Porty"
+	mfaPendingTTL     = 5 * time.Minute
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFASetupRequired  = errors.New("start the two-factor setup first")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired two-factor token")
+)
+
+// MFAClaims defines the claims of the token proving the password step of a
+// login requiring a second factor
+type MFAClaims struct {
+	Purpose string `json:"Purpose"`
+	jwt.RegisteredClaims
+}
+
+// SetupMFA starts the enrollment of the user with a new TOTP secret. The
+// secret is only used once confirmed with EnableMFA.
+func SetupMFA(userID primitive.ObjectID) (models.MFASetupResponse, error) {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		return models.MFASetupResponse{}, err
+	}
+	if user.MFAEnabled() {
+		return models.MFASetupResponse{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return models.MFASetupResponse{}, err
+	}
+	encrypted, err := encryptSecret(secret)
+	if err != nil {
+		return models.MFASetupResponse{}, err
+	}
+
+	result, err := repositories.SetPendingMFASecret(user.ID, encrypted)
+	if err != nil {
+		return models.MFASetupResponse{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.MFASetupResponse{}, ErrMFAAlreadyEnabled
+	}
+
+	return models.MFASetupResponse{
+		Secret: secret,
+		URI:    utils.TOTPURI(mfaIssuer, user.Email, secret),
+	}, nil
+}
+
+// EnableMFA confirms the enrollment with a code of the pending secret and
+// returns the recovery codes, shown to the user this time only
+func EnableMFA(userID primitive.ObjectID, code string) ([]string, error) {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFA == nil || user.MFA.PendingSecret == "" {
+		return nil, ErrMFASetupRequired
+	}
+
+	secret, err := decryptSecret(user.MFA.PendingSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := repositories.EnableMFA(user.ID, user.MFA.PendingSecret, hashes, step)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	return codes, nil
+}
+
+// DisableMFA turns two-factor off after re-authenticating the user and
+// checking a code
+func DisableMFA(userID primitive.ObjectID, accessTokenID, password, code, ip, userAgent string) error {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled() {
+		return ErrMFANotEnabled
+	}
+	if err := Reauthenticate(user, accessTokenID, password, ip, userAgent); err != nil {
+		return err
+	}
+	if err := verifyUserMFACode(user, code, ip, userAgent); err != nil {
+		return err
+	}
+
+	_, err = repositories.DisableMFA(user.ID)
+	return err
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user after
+// re-authenticating them and checking a code
+func RegenerateRecoveryCodes(userID primitive.ObjectID, accessTokenID, password, code, ip, userAgent string) ([]string, error) {
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled() {
+		return nil, ErrMFANotEnabled
+	}
+	if err := Reauthenticate(user, accessTokenID, password, ip, userAgent); err != nil {
+		return nil, err
+	}
+	if err := verifyUserMFACode(user, code, ip, userAgent); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repositories.SetRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// GenerateMFAToken returns the short-lived token exchanged along with a code
+// for a session through VerifyMFALogin
+func GenerateMFAToken(user models.User) (string, error) {
+	now := time.Now()
+	claims := &MFAClaims{
+		Purpose: TokenPurposeMFAPending,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			Subject:   user.ID.Hex(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaPendingTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "porty-go",
+		},
+	}
+
+	return signToken(claims)
+}
+
+// VerifyMFALogin checks the two-factor token and code of a login. The token
+// can only be used once and wrong codes count as failed logins.
+func VerifyMFALogin(mfaToken, code, ip, userAgent string) (models.User, error) {
+	claims := &MFAClaims{}
+	if err := ParseToken(mfaToken, claims); err != nil || claims.Purpose != TokenPurposeMFAPending {
+		return models.User{}, ErrInvalidMFAToken
+	}
+
+	revoked, err := IsTokenRevoked(claims.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if revoked {
+		return models.User{}, ErrInvalidMFAToken
+	}
+
+	userID, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return models.User{}, ErrInvalidMFAToken
+	}
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.User{}, ErrInvalidMFAToken
+		}
+		return models.User{}, err
+	}
+	if !user.MFAEnabled() {
+		return models.User{}, ErrInvalidMFAToken
+	}
+
+	if err := verifyUserMFACode(user, code, ip, userAgent); err != nil {
+		return models.User{}, err
+	}
+	recordLoginSuccess(user, ip, userAgent)
+
+	if err := revokeAccessToken(user.ID, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// verifyUserMFACode checks a code of the user. Wrong codes count towards the
+// same throttling and lockout as failed logins.
+func verifyUserMFACode(user models.User, code, ip, userAgent string) error {
+	if err := checkLoginThrottle(user.Email, ip); err != nil {
+		recordAuthEvent(models.AuthEventLoginThrottled, &user.ID, user.Email, ip, userAgent, err.Error())
+		return err
+	}
+	if err := checkAccountLock(user, ip, userAgent); err != nil {
+		return err
+	}
+
+	if err := verifyMFACode(user, code); err != nil {
+		if err == ErrInvalidMFACode {
+			if err := recordLoginFailure(&user, user.Email, ip, userAgent, "wrong two-factor code"); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	if err := loginAttempts.Reset(emailAttemptKey(user.Email)); err != nil {
+		log.Println("Error resetting login attempts:", err)
+	}
+	return nil
+}
+
+// verifyMFACode accepts a TOTP code not used before or an unused recovery
+// code of the user
+func verifyMFACode(user models.User, code string) error {
+	secret, err := decryptSecret(user.MFA.Secret)
+	if err != nil {
+		return err
+	}
+	if secretNeedsRotation(user.MFA.Secret) {
+		rotateMFASecret(user.ID, secret)
+	}
+
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now(), totpSkew); ok {
+		result, err := repositories.UseTOTPStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	result, err := repositories.UseRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// generateRecoveryCodes returns new recovery codes formatted as
+// xxxxxxxx-xxxxxxxx along with their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		codes[i] = code[:len(code)/2] + "-" + code[len(code)/2:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// rotateMFASecret rewrites the TOTP secret with the current encryption key.
+// Failing only delays the rotation to the next login.
+func rotateMFASecret(userID primitive.ObjectID, secret string) {
+	encrypted, err := encryptSecret(secret)
+	if err == nil {
+		_, err = repositories.UpdateUserFields(userID, bson.M{"mfa.secret": encrypted})
+	}
+	if err != nil {
+		log.Println("Error rotating MFA secret:", err)
+	}
+}
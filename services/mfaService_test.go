@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRegenerateRecoveryCodesThrottlesWrongCodes(t *testing.T) {
+	t.Setenv("ENCRYPT_KEYS", "")
+	t.Setenv("ENCRYPT_KEY", "test-encrypt-key")
+	if err := LoadEncryptionKeys(); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := encryptSecret("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("Password1!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetAttemptStore(NewMemoryAttemptStore())
+
+	id := primitive.NewObjectID()
+	user := mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "email", Value: "player@example.com"},
+		{Key: "password", Value: string(hash)},
+		{Key: "mfa", Value: bson.D{{Key: "enabled", Value: true}, {Key: "secret", Value: secret}}},
+	})
+	notModified := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}}
+	mt := mockRepositories(t)
+
+	// The right password does not clear the failures of the wrong codes
+	for i := 0; i < loginDelayAfterFailures; i++ {
+		mt.AddMockResponses(user, notModified, mtest.CreateSuccessResponse())
+		_, err := RegenerateRecoveryCodes(id, "", "Password1!", "not-a-recovery-code", "203.0.113.7", "test")
+		if err != ErrInvalidMFACode {
+			t.Fatalf("attempt %d: error = %v, want ErrInvalidMFACode", i, err)
+		}
+	}
+
+	mt.AddMockResponses(user, mtest.CreateSuccessResponse())
+	_, err = RegenerateRecoveryCodes(id, "", "Password1!", "not-a-recovery-code", "203.0.113.7", "test")
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) {
+		t.Errorf("error after %d wrong codes = %v, want a LoginThrottledError", loginDelayAfterFailures, err)
+	}
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"porty-go/config"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	oauth2api "google.golang.org/api/oauth2/v2"
+)
+
+const (
+	OAuthProviderGoogle  = "google"
+	OAuthProviderGitHub  = "github"
+	OAuthProviderDiscord = "discord"
+	OAuthProviderOIDC    = "oidc"
+
+	oidcDiscoveryTTL = time.Hour
+)
+
+var (
+	ErrUnknownOAuthProvider  = errors.New("unknown login provider")
+	ErrOAuthProviderDisabled = errors.New("login provider is not configured")
+	ErrOAuthEmailRequired    = errors.New("the login provider did not share a verified email")
+)
+
+// OAuthIdentity is the account of the user at a login provider
+type OAuthIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OAuthProvider is an external login provider
+type OAuthProvider interface {
+	// Config returns the OAuth2 client configuration, or
+	// ErrOAuthProviderDisabled when the provider has no client set up
+	Config(ctx context.Context) (*oauth2.Config, error)
+	// Identity fetches the account the token was issued for
+	Identity(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token) (OAuthIdentity, error)
+}
+
+// oauthProviders maps the :provider route parameter to the provider. The
+// configuration is read from the environment on every login.
+var oauthProviders = map[string]func() OAuthProvider{
+	OAuthProviderGoogle:  func() OAuthProvider { return googleOAuthProvider{} },
+	OAuthProviderGitHub:  func() OAuthProvider { return githubOAuthProvider{} },
+	OAuthProviderDiscord: func() OAuthProvider { return discordOAuthProvider{} },
+	OAuthProviderOIDC:    func() OAuthProvider { return oidcOAuthProvider{} },
+}
+
+// GetOAuthProvider returns the login provider with the given name
+func GetOAuthProvider(name string) (OAuthProvider, error) {
+	newProvider, ok := oauthProviders[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrUnknownOAuthProvider
+	}
+	return newProvider(), nil
+}
+
+type googleOAuthProvider struct{}
+
+func (googleOAuthProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	return configuredOAuth(config.GoogleOAuthConfig())
+}
+
+func (googleOAuthProvider) Identity(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token) (OAuthIdentity, error) {
+	oauth2Service, err := oauth2api.New(oauthConfig.Client(ctx, token))
+	if err != nil {
+		return OAuthIdentity{}, err
+	}
+
+	userInfo, err := oauth2Service.Userinfo.Get().Context(ctx).Do()
+	if err != nil {
+		return OAuthIdentity{}, err
+	}
+
+	return OAuthIdentity{
+		Provider:      OAuthProviderGoogle,
+		Subject:       userInfo.Id,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.VerifiedEmail != nil && *userInfo.VerifiedEmail,
+		Name:          userInfo.Name,
+	}, nil
+}
+
+type githubOAuthProvider struct{}
+
+func (githubOAuthProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	return configuredOAuth(config.GitHubOAuthConfig())
+}
+
+func (githubOAuthProvider) Identity(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token) (OAuthIdentity, error) {
+	client := oauthConfig.Client(ctx, token)
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", &user); err != nil {
+		return OAuthIdentity{}, err
+	}
+
+	// The public profile email may be unverified, use the primary one instead
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return OAuthIdentity{}, err
+	}
+
+	identity := OAuthIdentity{
+		Provider: OAuthProviderGitHub,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
+
+type discordOAuthProvider struct{}
+
+func (discordOAuthProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	return configuredOAuth(config.DiscordOAuthConfig())
+}
+
+func (discordOAuthProvider) Identity(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token) (OAuthIdentity, error) {
+	var user struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Email      string `json:"email"`
+		Verified   bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, oauthConfig.Client(ctx, token), "https://discord.com/api/users/@me", &user); err != nil {
+		return OAuthIdentity{}, err
+	}
+
+	identity := OAuthIdentity{
+		Provider:      OAuthProviderDiscord,
+		Subject:       user.ID,
+		Email:         user.Email,
+		EmailVerified: user.Verified,
+		Name:          user.GlobalName,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Username
+	}
+	return identity, nil
+}
+
+// oidcOAuthProvider is any OpenID Connect provider, set up from the discovery
+// document of OIDC_ISSUER_URL
+type oidcOAuthProvider struct{}
+
+// oidcDiscovery is the part of the OpenID provider metadata used for login
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+var oidcDiscoveryCache struct {
+	sync.Mutex
+	issuer    string
+	document  oidcDiscovery
+	fetchedAt time.Time
+}
+
+func (oidcOAuthProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	oauthConfig, err := configuredOAuth(config.OIDCOAuthConfig())
+	if err != nil {
+		return nil, err
+	}
+	issuer := config.OIDCIssuerURL()
+	if issuer == "" {
+		return nil, ErrOAuthProviderDisabled
+	}
+
+	discovery, err := discoverOIDC(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	oauthConfig.Endpoint = oauth2.Endpoint{
+		AuthURL:  discovery.AuthorizationEndpoint,
+		TokenURL: discovery.TokenEndpoint,
+	}
+	return oauthConfig, nil
+}
+
+func (oidcOAuthProvider) Identity(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token) (OAuthIdentity, error) {
+	discovery, err := discoverOIDC(ctx, config.OIDCIssuerURL())
+	if err != nil {
+		return OAuthIdentity{}, err
+	}
+	if discovery.UserinfoEndpoint == "" {
+		return OAuthIdentity{}, errors.New("OIDC provider has no userinfo endpoint")
+	}
+
+	var userInfo struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := getJSON(ctx, oauthConfig.Client(ctx, token), discovery.UserinfoEndpoint, &userInfo); err != nil {
+		return OAuthIdentity{}, err
+	}
+	if userInfo.Subject == "" {
+		return OAuthIdentity{}, errors.New("OIDC userinfo has no subject")
+	}
+
+	return OAuthIdentity{
+		Provider:      OAuthProviderOIDC,
+		Subject:       userInfo.Subject,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.EmailVerified,
+		Name:          userInfo.Name,
+	}, nil
+}
+
+// discoverOIDC fetches the provider metadata of the issuer, cached for
+// oidcDiscoveryTTL
+func discoverOIDC(ctx context.Context, issuer string) (oidcDiscovery, error) {
+	oidcDiscoveryCache.Lock()
+	defer oidcDiscoveryCache.Unlock()
+
+	if oidcDiscoveryCache.issuer == issuer && time.Since(oidcDiscoveryCache.fetchedAt) < oidcDiscoveryTTL {
+		return oidcDiscoveryCache.document, nil
+	}
+
+	var document oidcDiscovery
+	if err := getJSON(ctx, &http.Client{Timeout: 10 * time.Second}, issuer+"/.well-known/openid-configuration", &document); err != nil {
+		return oidcDiscovery{}, err
+	}
+	if strings.TrimSuffix(document.Issuer, "/") != issuer {
+		return oidcDiscovery{}, fmt.Errorf("OIDC discovery issuer %q does not match %q", document.Issuer, issuer)
+	}
+	if document.AuthorizationEndpoint == "" || document.TokenEndpoint == "" {
+		return oidcDiscovery{}, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	oidcDiscoveryCache.issuer = issuer
+	oidcDiscoveryCache.document = document
+	oidcDiscoveryCache.fetchedAt = time.Now()
+	return document, nil
+}
+
+func configuredOAuth(oauthConfig *oauth2.Config) (*oauth2.Config, error) {
+	if oauthConfig.ClientID == "" {
+		return nil, ErrOAuthProviderDisabled
+	}
+	return oauthConfig, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return decodeJSONResponse(resp, target)
+}
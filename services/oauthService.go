@@ -0,0 +1,220 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"porty-go/config"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	OAuthStateCookie = "oauth_state"
+	OAuthStateTTL    = 10 * time.Minute
+	loginCodeTTL     = time.Minute
+)
+
+var (
+	ErrInvalidOAuthState = errors.New("invalid or expired OAuth state")
+	ErrInvalidRedirect   = errors.New("redirect_to is not an allowed origin")
+	ErrInvalidLoginCode  = errors.New("invalid or expired login code")
+
+	ErrOAuthStateSecretMissing = errors.New("OAUTH_STATE_SECRET must be set to sign OAuth state")
+)
+
+// OAuthState is kept in a signed cookie between the login redirect and the
+// provider callback. LinkUserID is set when the login links the identity to
+// that user instead of logging in.
+type OAuthState struct {
+	Provider   string `json:"p"`
+	State      string `json:"s"`
+	Verifier   string `json:"v"`
+	RedirectTo string `json:"r,omitempty"`
+	LinkUserID string `json:"u,omitempty"`
+	ExpiresAt  int64  `json:"e"`
+}
+
+// NewOAuthState creates a random state for a login with the provider using
+// the PKCE verifier and redirecting to redirectTo once done
+func NewOAuthState(provider, verifier, redirectTo string) (OAuthState, error) {
+	state, err := generateOpaqueToken()
+	if err != nil {
+		return OAuthState{}, err
+	}
+
+	return OAuthState{
+		Provider:   provider,
+		State:      state,
+		Verifier:   verifier,
+		RedirectTo: redirectTo,
+		ExpiresAt:  time.Now().Add(OAuthStateTTL).Unix(),
+	}, nil
+}
+
+// EncodeOAuthState serializes and signs the state for the cookie
+func EncodeOAuthState(state OAuthState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signOAuthState(encoded)
+	if err != nil {
+		return "", err
+	}
+	return encoded + "." + signature, nil
+}
+
+// DecodeOAuthState verifies the cookie value and checks that it carries the
+// state returned by the provider
+func DecodeOAuthState(cookie, provider, state string) (OAuthState, error) {
+	encoded, signature, found := strings.Cut(cookie, ".")
+	if !found {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+	expected, err := signOAuthState(encoded)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+
+	var decoded OAuthState
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+	if decoded.ExpiresAt < time.Now().Unix() || decoded.Provider != provider {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(decoded.State), []byte(state)) != 1 {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+	return decoded, nil
+}
+
+// ValidateRedirect returns redirectTo when its origin is one of
+// config.AllowedOrigins. An empty value is accepted and means the default
+// frontend page.
+func ValidateRedirect(redirectTo string) (string, error) {
+	if redirectTo == "" {
+		return "", nil
+	}
+
+	parsed, err := url.Parse(redirectTo)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.User != nil {
+		return "", ErrInvalidRedirect
+	}
+
+	origin := parsed.Scheme + "://" + parsed.Host
+	for _, allowed := range config.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return redirectTo, nil
+		}
+	}
+	return "", ErrInvalidRedirect
+}
+
+// LoginRedirectURL appends the login code to the redirect target, defaulting
+// to the success page of the frontend
+func LoginRedirectURL(redirectTo, code string) string {
+	return frontendRedirectURL(redirectTo, "code", code)
+}
+
+// LinkRedirectURL appends the code confirming a provider link to the redirect
+// target
+func LinkRedirectURL(redirectTo, code string) string {
+	return frontendRedirectURL(redirectTo, "link_code", code)
+}
+
+// CreateLoginCode issues a single-use code the frontend exchanges for tokens
+func CreateLoginCode(userID primitive.ObjectID) (string, error) {
+	return createLoginCode(userID, models.LoginCodePurposeLogin, nil)
+}
+
+func createLoginCode(userID primitive.ObjectID, purpose string, identity *models.LinkedIdentity) (string, error) {
+	code, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = repositories.CreateLoginCode(models.LoginCode{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Purpose:   purpose,
+		CodeHash:  hashToken(code),
+		Identity:  identity,
+		ExpiresAt: now.Add(loginCodeTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemLoginCode consumes a login code and returns its user
+func RedeemLoginCode(code string) (models.User, error) {
+	loginCode, err := repositories.UseLoginCode(hashToken(code), models.LoginCodePurposeLogin)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.User{}, ErrInvalidLoginCode
+		}
+		return models.User{}, err
+	}
+
+	user, err := repositories.GetUserById(loginCode.UserID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.User{}, ErrInvalidLoginCode
+		}
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func frontendRedirectURL(redirectTo, key, value string) string {
+	if redirectTo == "" {
+		redirectTo = GetFrontendURL() + "/auth/success"
+	}
+
+	parsed, err := url.Parse(redirectTo)
+	if err != nil {
+		return GetFrontendURL() + "/auth/success?" + key + "=" + url.QueryEscape(value)
+	}
+	query := parsed.Query()
+	query.Set(key, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// signOAuthState signs with OAUTH_STATE_SECRET, or JWT_SECRET for setups
+// still signing tokens with it
+func signOAuthState(encoded string) (string, error) {
+	secret := os.Getenv("OAUTH_STATE_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return "", ErrOAuthStateSecretMissing
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
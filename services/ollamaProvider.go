@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"porty-go/models"
+	"strings"
+)
+
+type OllamaRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+// OllamaResponse is both the full response and a single line of the
+// newline-delimited stream
+type OllamaResponse struct {
+	Model   string `json:"model"`
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// ollamaProvider talks to Ollama-style local /api/chat endpoints
+type ollamaProvider struct {
+	service models.IntegrationService
+	client  *http.Client
+}
+
+func (p *ollamaProvider) headers() map[string]string {
+	headers := map[string]string{}
+	if p.service.Token != "" {
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", p.service.Token)
+	}
+	return headers
+}
+
+func (p *ollamaProvider) Complete(ctx context.Context, messages []Message) (*ChatCompletion, error) {
+	data := OllamaRequest{
+		Model:    p.service.Model,
+		Messages: messages,
+		Stream:   false,
+	}
+
+	resp, err := postJSON(ctx, p.client, p.service.ServiceUrl, p.headers(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	var botResp OllamaResponse
+	if err := decodeJSONResponse(resp, &botResp); err != nil {
+		return nil, err
+	}
+	if botResp.Error != "" {
+		return nil, errors.New(botResp.Error)
+	}
+
+	return checkCompletion(&ChatCompletion{
+		Content: botResp.Message.Content,
+		Model:   botResp.Model,
+		Usage:   botResp.tokenUsage(),
+	})
+}
+
+func (p *ollamaProvider) Stream(ctx context.Context, messages []Message, onDelta func(delta string) error) (*ChatCompletion, error) {
+	data := OllamaRequest{
+		Model:    p.service.Model,
+		Messages: messages,
+		Stream:   true,
+	}
+
+	resp, err := postJSON(ctx, p.client, p.service.ServiceUrl, p.headers(), data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	completion := &ChatCompletion{}
+	err = scanLines(resp.Body, func(line string) (bool, error) {
+		var chunk OllamaResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			fmt.Println("Error unmarshalling stream chunk:", err)
+			return false, err
+		}
+		if chunk.Error != "" {
+			return false, errors.New(chunk.Error)
+		}
+
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+		if err := emitDelta(&content, chunk.Message.Content, onDelta); err != nil {
+			return false, err
+		}
+		if chunk.Done {
+			completion.Usage = chunk.tokenUsage()
+		}
+		return chunk.Done, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	completion.Content = content.String()
+	return checkCompletion(completion)
+}
+
+func (r OllamaResponse) tokenUsage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"porty-go/models"
+	"strings"
+)
+
+// MessagesContainer holds an array of messages
+type MessagesContainer struct {
+	Messages      []Message            `json:"messages"`
+	Model         string               `json:"model"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type OpenAIUsage struct {
+	CompletionTokens int `json:"completion_tokens"`
+	PromptTokens     int `json:"prompt_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type BotResponse struct {
+	ID                string      `json:"id"`
+	Object            string      `json:"object"`
+	Created           int64       `json:"created"`
+	Model             string      `json:"model"`
+	SystemFingerprint string      `json:"system_fingerprint"`
+	Usage             OpenAIUsage `json:"usage"`
+	Choices           []struct {
+		FinishReason string `json:"finish_reason"`
+		Index        int    `json:"index"`
+		Message      struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// BotStreamChunk is a single `data:` event of a streamed completion
+type BotStreamChunk struct {
+	ID      string       `json:"id"`
+	Model   string       `json:"model"`
+	Usage   *OpenAIUsage `json:"usage"`
+	Choices []struct {
+		FinishReason *string `json:"finish_reason"`
+		Index        int     `json:"index"`
+		Delta        struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// openAIProvider talks to OpenAI-compatible chat completion endpoints
+type openAIProvider struct {
+	service models.IntegrationService
+	client  *http.Client
+}
+
+func (p *openAIProvider) headers() map[string]string {
+	return map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", p.service.Token),
+	}
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, messages []Message) (*ChatCompletion, error) {
+	data := MessagesContainer{
+		Messages: messages,
+		Model:    p.service.Model,
+	}
+
+	resp, err := postJSON(ctx, p.client, p.service.ServiceUrl, p.headers(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	var botResp BotResponse
+	if err := decodeJSONResponse(resp, &botResp); err != nil {
+		return nil, err
+	}
+
+	completion := &ChatCompletion{Model: botResp.Model, Usage: botResp.Usage.tokenUsage()}
+	if len(botResp.Choices) > 0 {
+		completion.Content = botResp.Choices[0].Message.Content
+	}
+	return checkCompletion(completion)
+}
+
+func (p *openAIProvider) Stream(ctx context.Context, messages []Message, onDelta func(delta string) error) (*ChatCompletion, error) {
+	data := MessagesContainer{
+		Messages:      messages,
+		Model:         p.service.Model,
+		Stream:        true,
+		StreamOptions: &OpenAIStreamOptions{IncludeUsage: true},
+	}
+
+	headers := p.headers()
+	headers["Accept"] = "text/event-stream"
+	resp, err := postJSON(ctx, p.client, p.service.ServiceUrl, headers, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	completion := &ChatCompletion{}
+	err = scanSSEData(resp.Body, func(payload string) (bool, error) {
+		if payload == "[DONE]" {
+			return true, nil
+		}
+
+		var chunk BotStreamChunk
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			fmt.Println("Error unmarshalling stream chunk:", err)
+			return false, err
+		}
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			completion.Usage = chunk.Usage.tokenUsage()
+		}
+		if len(chunk.Choices) == 0 {
+			return false, nil
+		}
+		return false, emitDelta(&content, chunk.Choices[0].Delta.Content, onDelta)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	completion.Content = content.String()
+	return checkCompletion(completion)
+}
+
+func (u OpenAIUsage) tokenUsage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
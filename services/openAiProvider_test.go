@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"porty-go/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sseServer answers every request with the frames, flushing after each so a
+// frame can end in the middle of a line
+func sseServer(t *testing.T, status int, frames ...string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body MessagesContainer
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !body.Stream {
+			http.Error(w, "expected a streamed completion request", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(status)
+		for _, frame := range frames {
+			_, _ = w.Write([]byte(frame))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func streamFrom(t *testing.T, server *httptest.Server) ([]string, *ChatCompletion, error) {
+	t.Helper()
+	provider, err := NewLLMProvider(models.IntegrationService{
+		ServiceUrl: server.URL,
+		Model:      "gpt-test",
+		Provider:   ProviderOpenAI,
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deltas []string
+	completion, err := provider.Stream(context.Background(), []Message{{Role: "user", Content: "Hi"}}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	return deltas, completion, err
+}
+
+func TestOpenAIStreamParsesChunks(t *testing.T) {
+	server := sseServer(t, http.StatusOK,
+		": keep-alive\n\n",
+		`data: {"model":"gpt-test-1","choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`+"\n\n",
+		`data: {"choices":[{"delta":{"con`,
+		`tent":"lo"}}]}`+"\n\n",
+		`data: {"choices":[{"delta":{},"finish_reason":"stop"}]}`+"\n\n",
+		`data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`+"\n\n",
+		"data: [DONE]\n\n",
+		`data: {"choices":[{"delta":{"content":" after done"}}]}`+"\n\n",
+	)
+
+	deltas, completion, err := streamFrom(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Hel", "lo"}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas = %q, want %q", deltas, want)
+	}
+	if completion.Content != "Hello" || completion.Model != "gpt-test-1" {
+		t.Errorf("completion = %+v, want Hello from gpt-test-1", completion)
+	}
+	if completion.Usage != (TokenUsage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}) {
+		t.Errorf("usage = %+v", completion.Usage)
+	}
+}
+
+func TestOpenAIStreamErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		frames []string
+		want   string
+	}{
+		{"upstream error", http.StatusInternalServerError, []string{`{"error":"overloaded"}`}, "chat service returned 500"},
+		{"malformed chunk", http.StatusOK, []string{`data: {"choices":[{"delta":` + "\n\n"}, "unexpected end of JSON input"},
+		{"no content", http.StatusOK, []string{"data: [DONE]\n\n"}, "empty response from chat service"},
+		{"cut before content", http.StatusOK, []string{`data: {"choices":[{"delta":{"role":"assistant"}}]}` + "\n\n"}, "empty response from chat service"},
+	}
+	for _, test := range tests {
+		_, completion, err := streamFrom(t, sseServer(t, test.status, test.frames...))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: completion = %+v, error = %v, want %q", test.name, completion, err, test.want)
+		}
+	}
+}
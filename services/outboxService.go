@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"porty-go/models"
+	"porty-go/repositories"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	outboxMaxAttempts  = 5
+	outboxPollInterval = 5 * time.Second
+	outboxSendTimeout  = 30 * time.Second
+	outboxBaseBackoff  = 30 * time.Second
+	outboxMaxBackoff   = time.Hour
+	outboxListLimit    = 100
+)
+
+var (
+	ErrOutboxEmailNotFound  = errors.New("email not found")
+	ErrOutboxEmailNotFailed = errors.New("only failed emails can be resent")
+)
+
+// EnqueueEmail stores the email in the outbox, to be delivered by the worker
+func EnqueueEmail(email Email) error {
+	now := time.Now()
+	_, err := repositories.CreateOutboxEmail(models.OutboxEmail{
+		ID:            primitive.NewObjectID(),
+		To:            email.To,
+		Subject:       email.Subject,
+		TextBody:      email.TextBody,
+		HTMLBody:      email.HTMLBody,
+		Status:        models.OutboxStatusPending,
+		MaxAttempts:   outboxMaxAttempts,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	return err
+}
+
+// StartOutboxWorker delivers queued emails with the mailer until ctx is done
+func StartOutboxWorker(ctx context.Context, mailer Mailer) {
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			processOutbox(ctx, mailer)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// processOutbox sends every email currently due
+func processOutbox(ctx context.Context, mailer Mailer) {
+	for ctx.Err() == nil {
+		email, err := repositories.ClaimOutboxEmail(outboxSendTimeout * 2)
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				log.Println("Error claiming outbox email:", err)
+			}
+			return
+		}
+		deliverOutboxEmail(ctx, mailer, email)
+	}
+}
+
+func deliverOutboxEmail(ctx context.Context, mailer Mailer, email models.OutboxEmail) {
+	sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+	defer cancel()
+
+	attempts := email.Attempts + 1
+	err := mailer.Send(sendCtx, Email{
+		To:       email.To,
+		Subject:  email.Subject,
+		TextBody: email.TextBody,
+		HTMLBody: email.HTMLBody,
+	})
+	if err == nil {
+		if _, err := repositories.MarkOutboxEmailSent(email.ID, attempts); err != nil {
+			log.Println("Error marking outbox email as sent:", err)
+		}
+		return
+	}
+
+	maxAttempts := email.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = outboxMaxAttempts
+	}
+
+	status := models.OutboxStatusPending
+	if attempts >= maxAttempts {
+		status = models.OutboxStatusDead
+		log.Printf("Giving up on email %s to %s after %d attempts: %v", email.ID.Hex(), email.To, attempts, err)
+	}
+
+	_, updateErr := repositories.MarkOutboxEmailFailed(email.ID, status, attempts, time.Now().Add(outboxBackoff(attempts)), err.Error())
+	if updateErr != nil {
+		log.Println("Error recording outbox email failure:", updateErr)
+	}
+}
+
+// outboxBackoff doubles the delay after every failed attempt
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxBaseBackoff
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return delay
+}
+
+func ListOutboxEmails(status string) ([]models.OutboxEmail, error) {
+	return repositories.ListOutboxEmails(status, outboxListLimit)
+}
+
+// ResendOutboxEmail queues a failed email again
+func ResendOutboxEmail(id string) (models.OutboxEmail, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.OutboxEmail{}, ErrOutboxEmailNotFound
+	}
+
+	if _, err := repositories.GetOutboxEmail(objID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.OutboxEmail{}, ErrOutboxEmailNotFound
+		}
+		return models.OutboxEmail{}, err
+	}
+
+	result, err := repositories.ResetOutboxEmail(objID)
+	if err != nil {
+		return models.OutboxEmail{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.OutboxEmail{}, ErrOutboxEmailNotFailed
+	}
+
+	return repositories.GetOutboxEmail(objID)
+}
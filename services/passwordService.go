@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"porty-go/models"
+	"porty-go/repositories"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordResetTTL  = time.Hour
+	minPasswordLength = 8
+
+	passwordResetCooldown = time.Minute
+	passwordResetWindow   = 24 * time.Hour
+	passwordResetMax      = 5
+)
+
+var (
+	ErrInvalidResetToken    = errors.New("invalid or expired reset token")
+	ErrWeakPassword         = errors.New("password must be at least 8 characters long")
+	ErrCurrentPasswordWrong = errors.New("current password is incorrect")
+)
+
+// RequestPasswordReset emails a single-use reset link to the user, at most
+// once per passwordResetCooldown and passwordResetMax times per
+// passwordResetWindow. Unknown emails and requests over the limit are silently
+// ignored so the endpoint cannot be used to find accounts.
+func RequestPasswordReset(email string) error {
+	user, err := GetUserByEmail(email)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	windowAt := user.PasswordResetWindowAt
+	count := user.PasswordResetCount
+	if windowAt == nil || now.Sub(*windowAt) >= passwordResetWindow {
+		windowAt = &now
+		count = 0
+	}
+	if user.PasswordResetSentAt != nil && now.Sub(*user.PasswordResetSentAt) < passwordResetCooldown || count >= passwordResetMax {
+		log.Println("Password reset email rate limited for user", user.ID.Hex())
+		return nil
+	}
+
+	_, err = repositories.UpdateUserFields(user.ID, bson.M{
+		"passwordResetSentAt":   now,
+		"passwordResetWindowAt": *windowAt,
+		"passwordResetCount":    count + 1,
+	})
+	if err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = repositories.CreatePasswordReset(models.PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(passwordResetTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	resetLink := GetFrontendURL() + "/auth/reset-password?token=" + url.QueryEscape(token)
+	if err := SendPasswordResetEmail(user.Email, user.FullName, resetLink); err != nil {
+		log.Println("Error sending password reset email:", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password using an emailed reset token and ends
+// every session of the user
+func ResetPassword(token, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	reset, err := repositories.GetPasswordResetByHash(hashToken(token))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if reset.UsedAt != nil || reset.ExpiresAt.Before(time.Now()) {
+		return ErrInvalidResetToken
+	}
+
+	result, err := repositories.UsePasswordReset(reset.ID)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrInvalidResetToken
+	}
+
+	return changePassword(reset.UserID, newPassword)
+}
+
+// SetPassword sets the password of the user, requiring the current one when
+// the account already has a password. Every existing session is ended and a
+// new one is returned for the caller.
+func SetPassword(userID primitive.ObjectID, currentPassword, newPassword, userAgent, ip string) (models.TokenPair, error) {
+	if err := validatePassword(newPassword); err != nil {
+		return models.TokenPair{}, err
+	}
+
+	user, err := repositories.GetUserById(userID)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	if user.Password != "" {
+		if err := verifyUserPassword(user, currentPassword, ip, userAgent); err != nil {
+			return models.TokenPair{}, err
+		}
+	}
+
+	if err := changePassword(user.ID, newPassword); err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return IssueSession(user, userAgent, ip)
+}
+
+func SendPasswordResetEmail(to, name, resetLink string) error {
+	if name == "" {
+		name = to
+	}
+
+	data := struct {
+		Name      string
+		ResetLink string
+		ExpiresIn string
+	}{
+		Name:      name,
+		ResetLink: resetLink,
+		ExpiresIn: "1 hour",
+	}
+
+	body := "Use the following link to reset your Porty!!! password: " + resetLink
+	return sendTemplateEmail(to, "Reset your Porty!!! password", body, "templates/reset_password_email.html", data)
+}
+
+// changePassword stores the new password hash, unlocks the account,
+// invalidates pending reset tokens and ends every session of the user
+func changePassword(userID primitive.ObjectID, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if _, err := repositories.UpdateUserPassword(userID, string(hashedPassword)); err != nil {
+		return err
+	}
+	if _, err := repositories.UpdateUserFields(userID, bson.M{"lockedUntil": nil}); err != nil {
+		return err
+	}
+	if _, err := repositories.InvalidatePasswordResets(userID); err != nil {
+		return err
+	}
+	return LogoutAllSessions(userID)
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRequestPasswordResetLimitsEmails(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		fields bson.D
+		sends  bool
+	}{
+		{"first request", bson.D{}, true},
+		{"within the cooldown", bson.D{
+			{Key: "passwordResetSentAt", Value: now.Add(-10 * time.Second)},
+			{Key: "passwordResetWindowAt", Value: now.Add(-10 * time.Second)},
+			{Key: "passwordResetCount", Value: 1},
+		}, false},
+		{"window used up", bson.D{
+			{Key: "passwordResetSentAt", Value: now.Add(-time.Hour)},
+			{Key: "passwordResetWindowAt", Value: now.Add(-2 * time.Hour)},
+			{Key: "passwordResetCount", Value: passwordResetMax},
+		}, false},
+		{"window over", bson.D{
+			{Key: "passwordResetSentAt", Value: now.Add(-time.Hour)},
+			{Key: "passwordResetWindowAt", Value: now.Add(-passwordResetWindow - time.Hour)},
+			{Key: "passwordResetCount", Value: passwordResetMax},
+		}, true},
+	}
+
+	mt := mockRepositories(t)
+	for _, test := range tests {
+		user := append(bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "email", Value: "player@example.com"},
+		}, test.fields...)
+		mt.ClearMockResponses()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "tedy.users", mtest.FirstBatch, user),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		mt.ClearEvents()
+
+		if err := RequestPasswordReset("player@example.com"); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		inserts := 0
+		for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+			if event.CommandName == "insert" {
+				inserts++
+			}
+		}
+		if sent := inserts > 0; sent != test.sends {
+			t.Errorf("%s: reset created = %v, want %v", test.name, sent, test.sends)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrEmptyProfileUpdate = errors.New("no field to update")
+	ErrFullNameRequired   = errors.New("fullName cannot be empty")
+	ErrInvalidAvatarURL   = errors.New("avatarUrl must be an absolute http or https URL")
+	ErrInvalidLocale      = errors.New("locale must be a BCP 47 language tag such as en or pt-BR")
+	ErrInvalidTimezone    = errors.New("timezone must be an IANA time zone such as Europe/Paris")
+)
+
+// GetProfile returns the user behind the access token
+func GetProfile(userID primitive.ObjectID) (models.User, error) {
+	return repositories.GetUserById(userID)
+}
+
+// UpdateProfile sets only the fields present in the request and returns the
+// updated user. Locales are stored in their canonical form.
+func UpdateProfile(userID primitive.ObjectID, request models.UpdateProfileRequest) (models.User, error) {
+	set, unset, err := profileUpdate(request)
+	if err != nil {
+		return models.User{}, err
+	}
+	return updateUserFields(userID, request.Version, set, unset)
+}
+
+// profileUpdate validates the profile fields present in the request and
+// returns the fields to set and unset
+func profileUpdate(request models.UpdateProfileRequest) (bson.M, bson.M, error) {
+	set := bson.M{}
+	unset := bson.M{}
+
+	if request.FullName != nil {
+		fullName := strings.TrimSpace(*request.FullName)
+		if fullName == "" {
+			return nil, nil, ErrFullNameRequired
+		}
+		set["fullName"] = fullName
+	}
+
+	optional := []struct {
+		field    string
+		value    *string
+		validate func(string) (string, error)
+	}{
+		{"displayName", request.DisplayName, func(value string) (string, error) { return value, nil }},
+		{"avatarUrl", request.AvatarURL, validateAvatarURL},
+		{"locale", request.Locale, validateLocale},
+		{"timezone", request.Timezone, validateTimezone},
+	}
+	for _, field := range optional {
+		if field.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*field.value)
+		if value == "" {
+			unset[field.field] = ""
+			continue
+		}
+		value, err := field.validate(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		set[field.field] = value
+	}
+	return set, unset, nil
+}
+
+// updateUserFields applies a partial update at the expected version, telling
+// a missing user (ErrUserNotFound) from a stale version (ErrVersionConflict)
+func updateUserFields(userID primitive.ObjectID, version *int64, set, unset bson.M) (models.User, error) {
+	if len(set) == 0 && len(unset) == 0 {
+		return models.User{}, ErrEmptyProfileUpdate
+	}
+
+	set["updatedAt"] = time.Now()
+	user, err := repositories.UpdateUserVersioned(userID, version, set, unset)
+	if err == nil {
+		return user, nil
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return models.User{}, ErrEmailTaken
+	}
+	if err != mongo.ErrNoDocuments {
+		return models.User{}, err
+	}
+
+	if _, err := repositories.GetUserById(userID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.User{}, ErrUserNotFound
+		}
+		return models.User{}, err
+	}
+	return models.User{}, ErrVersionConflict
+}
+
+func validateAvatarURL(value string) (string, error) {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return "", ErrInvalidAvatarURL
+	}
+	return parsed.String(), nil
+}
+
+func validateLocale(value string) (string, error) {
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", ErrInvalidLocale
+	}
+	return tag.String(), nil
+}
+
+// validateTimezone accepts IANA zone names, the zone database is embedded so
+// hosts without one still validate
+func validateTimezone(value string) (string, error) {
+	if value == "Local" {
+		return "", ErrInvalidTimezone
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		return "", ErrInvalidTimezone
+	}
+	return value, nil
+}
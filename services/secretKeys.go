@@ -0,0 +1,98 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"porty-go/utils"
+)
+
+// secretKeyConfig is an entry of ENCRYPT_KEYS, a base64 encoded 16, 24 or 32
+// byte AES key
+type secretKeyConfig struct {
+	Kid string `json:"kid"`
+	Key string `json:"key"`
+}
+
+// secretKeys encrypts the secrets stored in the database
+var secretKeys *utils.Keyring
+
+// LoadEncryptionKeys loads the keys of the stored secrets from ENCRYPT_KEYS,
+// a JSON array of keys. The first key encrypts and every key decrypts, so a
+// rotation adds the new key first and keeps the old ones until the secrets
+// they encrypted are rewritten. Without keys, a key is derived from
+// ENCRYPT_KEY. A 16 byte ENCRYPT_KEY also decrypts the secrets written before
+// the envelope.
+func LoadEncryptionKeys() error {
+	var configs []secretKeyConfig
+	if value := os.Getenv("ENCRYPT_KEYS"); value != "" {
+		if err := json.Unmarshal([]byte(value), &configs); err != nil {
+			return fmt.Errorf("invalid ENCRYPT_KEYS: %w", err)
+		}
+	}
+
+	legacySecret := os.Getenv("ENCRYPT_KEY")
+	keys := map[string][]byte{}
+	primary := ""
+	for _, config := range configs {
+		if _, ok := keys[config.Kid]; ok {
+			return fmt.Errorf("encryption key %q is configured twice", config.Kid)
+		}
+		key, err := base64.StdEncoding.DecodeString(config.Key)
+		if err != nil {
+			return fmt.Errorf("encryption key %q: %w", config.Kid, err)
+		}
+		keys[config.Kid] = key
+		if primary == "" {
+			primary = config.Kid
+		}
+	}
+
+	if len(keys) == 0 {
+		if legacySecret == "" {
+			return errors.New("ENCRYPT_KEYS or ENCRYPT_KEY must be set")
+		}
+		mac := hmac.New(sha256.New, []byte(legacySecret))
+		mac.Write([]byte("stored secrets"))
+		primary = "default"
+		keys[primary] = mac.Sum(nil)
+		log.Println("No encryption keys configured, deriving one from ENCRYPT_KEY")
+	}
+
+	var legacyKey []byte
+	if len(legacySecret) == 16 {
+		legacyKey = []byte(legacySecret)
+	}
+
+	ring, err := utils.NewKeyring(primary, keys, legacyKey)
+	if err != nil {
+		return err
+	}
+	secretKeys = ring
+	return nil
+}
+
+func encryptSecret(plainText string) (string, error) {
+	if secretKeys == nil {
+		return "", utils.ErrNoEncryptKey
+	}
+	return secretKeys.Encrypt(plainText)
+}
+
+func decryptSecret(encryptedText string) (string, error) {
+	if secretKeys == nil {
+		return "", utils.ErrNoEncryptKey
+	}
+	return secretKeys.Decrypt(encryptedText)
+}
+
+// secretNeedsRotation reports whether the secret was encrypted by an older
+// key or before the envelope
+func secretNeedsRotation(encryptedText string) bool {
+	return secretKeys != nil && !secretKeys.IsCurrent(encryptedText)
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"porty-go/models"
+	"porty-go/repositories"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, please login again")
+)
+
+// IssueSession starts a new session for the user, returning an access token
+// and the first refresh token of a new token family. Deactivated accounts and
+// accounts waiting for deletion are restored.
+func IssueSession(user models.User, userAgent, ip string) (models.TokenPair, error) {
+	reactivated, err := reactivateOnLogin(user, ip, userAgent)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	tokens, err := issueTokens(user, primitive.NewObjectID(), primitive.NewObjectID(), time.Now(), userAgent, ip)
+	tokens.Reactivated = reactivated
+	return tokens, err
+}
+
+// RefreshSession exchanges a refresh token for a new token pair. The presented
+// token is rotated; presenting it again revokes the whole family.
+func RefreshSession(refreshToken, userAgent, ip string) (models.TokenPair, error) {
+	stored, err := repositories.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return models.TokenPair{}, err
+	}
+
+	if stored.RevokedAt != nil {
+		if stored.ReplacedBy != nil {
+			log.Println("Refresh token reuse detected for user:", stored.UserID.Hex())
+			if err := revokeSessions(bson.M{"familyId": stored.FamilyID}); err != nil {
+				return models.TokenPair{}, err
+			}
+			return models.TokenPair{}, ErrRefreshTokenReused
+		}
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if stored.ExpiresAt.Before(time.Now()) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := repositories.GetUserById(stored.UserID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return models.TokenPair{}, err
+	}
+
+	if user.DeactivatedAt != nil || user.DeletedAt != nil {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err := CheckLoginVerification(user); err != nil {
+		return models.TokenPair{}, err
+	}
+
+	nextID := primitive.NewObjectID()
+	result, err := repositories.RotateRefreshToken(stored.ID, nextID)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if result.ModifiedCount == 0 {
+		// Another request rotated the token first
+		if err := revokeSessions(bson.M{"familyId": stored.FamilyID}); err != nil {
+			return models.TokenPair{}, err
+		}
+		return models.TokenPair{}, ErrRefreshTokenReused
+	}
+
+	return issueTokens(user, nextID, stored.FamilyID, stored.AuthTime, userAgent, ip)
+}
+
+// Logout ends the session of the given access token. When a refresh token is
+// given, its family is revoked even if it belongs to another device.
+func Logout(userID primitive.ObjectID, accessTokenID string, accessExpires time.Time, refreshToken string) error {
+	if err := revokeAccessToken(userID, accessTokenID, accessExpires); err != nil {
+		return err
+	}
+
+	var stored models.RefreshToken
+	var err error
+	if refreshToken != "" {
+		stored, err = repositories.GetRefreshTokenByHash(hashToken(refreshToken))
+	} else {
+		stored, err = repositories.GetRefreshTokenByAccessID(accessTokenID)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	if stored.UserID != userID {
+		return nil
+	}
+
+	return revokeSessions(bson.M{"familyId": stored.FamilyID})
+}
+
+// LogoutAllSessions revokes every refresh token of the user and denylists the
+// access tokens issued with them
+func LogoutAllSessions(userID primitive.ObjectID) error {
+	return revokeSessions(bson.M{"userId": userID})
+}
+
+// IsTokenRevoked reports whether the access token ID has been denylisted
+func IsTokenRevoked(accessTokenID string) (bool, error) {
+	if accessTokenID == "" {
+		return false, nil
+	}
+	return repositories.IsTokenRevoked(accessTokenID)
+}
+
+// revokeSessions revokes the active refresh tokens matching filter along with
+// their latest access tokens
+func revokeSessions(filter bson.M) error {
+	tokens, err := repositories.ListActiveRefreshTokens(filter)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if err := revokeAccessToken(token.UserID, token.AccessTokenID, token.AccessExpires); err != nil {
+			return err
+		}
+	}
+
+	_, err = repositories.RevokeRefreshTokens(filter)
+	return err
+}
+
+func revokeAccessToken(userID primitive.ObjectID, accessTokenID string, expiresAt time.Time) error {
+	if accessTokenID == "" || expiresAt.Before(time.Now()) {
+		return nil
+	}
+	return repositories.CreateRevokedToken(models.RevokedToken{
+		ID:        accessTokenID,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	})
+}
+
+// issueTokens creates an access token and a refresh token stored under id
+// within the token family started by a login at authTime
+func issueTokens(user models.User, id, familyID primitive.ObjectID, authTime time.Time, userAgent, ip string) (models.TokenPair, error) {
+	accessToken, claims, err := GenerateToken(user)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	refreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	now := time.Now()
+	_, err = repositories.CreateRefreshToken(models.RefreshToken{
+		ID:            id,
+		UserID:        user.ID,
+		FamilyID:      familyID,
+		TokenHash:     hashToken(refreshToken),
+		AccessTokenID: claims.ID,
+		AccessExpires: claims.ExpiresAt.Time,
+		UserAgent:     userAgent,
+		IP:            ip,
+		AuthTime:      authTime,
+		ExpiresAt:     now.Add(refreshTokenTTL()),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    claims.ExpiresAt.Unix() - now.Unix(),
+	}, nil
+}
+
+// generateOpaqueToken returns a random URL-safe token
+func generateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func accessTokenTTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)
+}
+
+func refreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)
+}
+
+// durationFromEnv parses a time.ParseDuration value, falling back when unset
+// or invalid
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QuotaExceededError is returned when a user has used up the token allowance
+// of the current day or month
+type QuotaExceededError struct {
+	Period string
+	Usage  models.UsageSummary
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s token quota exceeded", e.Period)
+}
+
+// ResetAt is when the exceeded period starts over
+func (e *QuotaExceededError) ResetAt() time.Time {
+	if e.Period == "daily" {
+		return e.Usage.Daily.ResetAt
+	}
+	return e.Usage.Monthly.ResetAt
+}
+
+// GetUsageSummary returns the token usage of the user for the current UTC day
+// and month along with the configured quotas
+func GetUsageSummary(userID primitive.ObjectID) (models.UsageSummary, error) {
+	now := time.Now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	daily, err := usagePeriod(userID, dayStart, dayStart.AddDate(0, 0, 1), tokenQuota("AI_DAILY_TOKEN_QUOTA"))
+	if err != nil {
+		return models.UsageSummary{}, err
+	}
+
+	monthly, err := usagePeriod(userID, monthStart, monthStart.AddDate(0, 1, 0), tokenQuota("AI_MONTHLY_TOKEN_QUOTA"))
+	if err != nil {
+		return models.UsageSummary{}, err
+	}
+
+	return models.UsageSummary{Daily: daily, Monthly: monthly}, nil
+}
+
+// CheckQuota returns a *QuotaExceededError when the user has no tokens left
+// for the current day or month
+func CheckQuota(userID primitive.ObjectID) error {
+	if tokenQuota("AI_DAILY_TOKEN_QUOTA") == nil && tokenQuota("AI_MONTHLY_TOKEN_QUOTA") == nil {
+		return nil
+	}
+
+	usage, err := GetUsageSummary(userID)
+	if err != nil {
+		return err
+	}
+
+	if usage.Daily.Remaining != nil && *usage.Daily.Remaining <= 0 {
+		return &QuotaExceededError{Period: "daily", Usage: usage}
+	}
+	if usage.Monthly.Remaining != nil && *usage.Monthly.Remaining <= 0 {
+		return &QuotaExceededError{Period: "monthly", Usage: usage}
+	}
+	return nil
+}
+
+// RecordUsage stores the token usage of a completion made in the conversation
+func RecordUsage(conversation models.Conversation, completion *ChatCompletion) error {
+	record := models.UsageRecord{
+		ID:               primitive.NewObjectID(),
+		UserID:           conversation.UserID,
+		ConversationID:   conversation.ID,
+		Model:            completion.Model,
+		PromptTokens:     completion.Usage.PromptTokens,
+		CompletionTokens: completion.Usage.CompletionTokens,
+		TotalTokens:      completion.Usage.TotalTokens,
+		CreatedAt:        time.Now(),
+	}
+	_, err := repositories.CreateUsageRecord(record)
+	return err
+}
+
+func usagePeriod(userID primitive.ObjectID, start, resetAt time.Time, quota *int) (models.UsagePeriod, error) {
+	totals, err := repositories.SumUsageSince(userID, start)
+	if err != nil {
+		return models.UsagePeriod{}, err
+	}
+
+	period := models.UsagePeriod{
+		UsageTotals: totals,
+		Start:       start,
+		ResetAt:     resetAt,
+		Quota:       quota,
+	}
+	if quota != nil {
+		remaining := *quota - totals.TotalTokens
+		if remaining < 0 {
+			remaining = 0
+		}
+		period.Remaining = &remaining
+	}
+	return period, nil
+}
+
+// tokenQuota reads a token quota from the environment. Unset, invalid or
+// non-positive values mean unlimited.
+func tokenQuota(key string) *int {
+	quota, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || quota <= 0 {
+		return nil
+	}
+	return &quota
+}
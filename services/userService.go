@@ -12,20 +12,44 @@ import (
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
-	oauth2api "google.golang.org/api/oauth2/v2"
-	"gopkg.in/gomail.v2"
 )
 
-func RegisterUser(user models.User) (*mongo.InsertOneResult, error) {
-	user.ID = primitive.NewObjectID()
-	user.IsGoogle = false
-	user.CreatedAt = time.Now()
-	user.UpdatedAt = nil
+var (
+	ErrUserNotFound             = errors.New("user not found")
+	ErrVersionConflict          = errors.New("the user has been changed since this version, reload it and try again")
+	ErrEmailTaken               = errors.New("this email is already used by another account")
+	ErrRoleChangeForbidden      = errors.New("only admins can change roles")
+	ErrPasswordChangeNotAllowed = errors.New("the password can only be changed through /auth/password")
+)
+
+// RegisterUser creates a password account from the request. Linked
+// identities are only added through the OAuth flows.
+func RegisterUser(request models.RegisterRequest) (*mongo.InsertOneResult, error) {
+	if err := validatePassword(request.Password); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := models.User{
+		ID:                    primitive.NewObjectID(),
+		FullName:              strings.TrimSpace(request.FullName),
+		Email:                 request.Email,
+		Password:              request.Password,
+		Role:                  models.RoleUser,
+		Identities:            nil,
+		IsVerify:              false,
+		VerifyAt:              nil,
+		CreatedAt:             now,
+		VerificationSentAt:    &now,
+		VerificationWindowAt:  &now,
+		VerificationSendCount: 1,
+	}
 
 	// Encrypt the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
@@ -47,120 +71,131 @@ func RegisterUser(user models.User) (*mongo.InsertOneResult, error) {
 		return nil, errors.New("user already exists")
 	}
 
-	// Generate the verification token
-	token, err := GenerateVerificationToken(user.Email)
-	if err != nil {
-		log.Println("Error generating verification token:", err)
-		return nil, errors.New("failed to generate verification token")
-	}
-
-	_ = godotenv.Load()
-	service := os.Getenv("SERVICE")
-	// Set the Swagger host dynamically
-	service = strings.ToLower(service)
-	var frontendURL string
-	if service == "local" {
-		frontendURL = os.Getenv("FRONT_END_URL_LOCAL")
-	} else {
-		frontendURL = os.Getenv("FRONT_END_URL_SERVER")
-	}
-
-	verificationLink := frontendURL + "/users/verify?token=" + token
-
-	// Send welcome email
-	if err := SendWelcomeEmail(user.Email, verificationLink); err != nil {
-		log.Println("Error sending welcome email:", err)
-		return nil, errors.New("failed to send welcome email")
-	}
-
 	result, err := repositories.CreateUser(user)
 	if err != nil {
 		log.Println("Error creating user:", err)
 		return nil, err
 	}
 
+	// Queue the welcome email, the account is usable even if this fails
+	if err := sendVerificationEmail(user); err != nil {
+		log.Println("Error sending welcome email:", err)
+	}
+
 	return result, nil
 }
 
 func GetUser(id string) (models.User, error) {
-	objID, _ := primitive.ObjectIDFromHex(id)
-	return repositories.GetUserById(objID)
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.User{}, ErrUserNotFound
+	}
+	user, err := repositories.GetUserById(objID)
+	if err == mongo.ErrNoDocuments {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, err
 }
 
 func GetUserByEmail(email string) (models.User, error) {
 	return repositories.GetUserByEmail(email)
 }
 
-func UpdateUserById(id string, user models.User) (*mongo.UpdateResult, error) {
-	objID, _ := primitive.ObjectIDFromHex(id)
-	now := time.Now()
-	user.UpdatedAt = &now
-	return repositories.UpdateUserById(objID, user)
-}
+// UpdateUser applies a partial update of the fields present in the request.
+// Only admins can change roles and passwords are changed through
+// /auth/password. A new email is kept pending, and the current email stays in
+// use, until the link sent to the new address is opened.
+func UpdateUser(id string, request models.UpdateUserRequest, asAdmin bool) (models.User, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.User{}, ErrUserNotFound
+	}
+	if request.Password != nil {
+		return models.User{}, ErrPasswordChangeNotAllowed
+	}
 
-func DeleteUser(id string) (*mongo.DeleteResult, error) {
-	objID, _ := primitive.ObjectIDFromHex(id)
-	return repositories.DeleteUser(objID)
+	existing, err := repositories.GetUserById(objID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.User{}, ErrUserNotFound
+		}
+		return models.User{}, err
+	}
+
+	set, unset, err := profileUpdate(request.UpdateProfileRequest)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if request.Role != nil && *request.Role != existing.GetRole() {
+		if !asAdmin {
+			return models.User{}, ErrRoleChangeForbidden
+		}
+		set["role"] = *request.Role
+	}
+
+	pendingEmail := ""
+	if request.Email != nil {
+		email := strings.TrimSpace(*request.Email)
+		switch {
+		case email == existing.Email:
+			if existing.PendingEmail != "" {
+				unset["pendingEmail"] = ""
+			}
+		case email != existing.PendingEmail:
+			other, err := repositories.GetUserByEmail(email)
+			if err == nil && other.ID != existing.ID {
+				return models.User{}, ErrEmailTaken
+			}
+			if err != nil && err != mongo.ErrNoDocuments {
+				return models.User{}, err
+			}
+			set["pendingEmail"] = email
+			pendingEmail = email
+		}
+	}
+
+	user, err := updateUserFields(objID, request.Version, set, unset)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if pendingEmail != "" {
+		if err := sendEmailChangeEmail(user, pendingEmail); err != nil {
+			log.Println("Error sending email change confirmation:", err)
+		}
+	}
+	return user, nil
 }
 
-func VerifyUser(id string, user models.User) (*mongo.UpdateResult, error) {
+func VerifyUser(id string) (*mongo.UpdateResult, error) {
 	objID, _ := primitive.ObjectIDFromHex(id)
-	user.IsVerify = true
-	now := time.Now()
-	user.VerifyAt = &now
-	return repositories.UpdateUserById(objID, user)
+	return repositories.UpdateUserFields(objID, bson.M{"isVerify": true, "VerifyAt": time.Now()})
 }
 
 func GenerateVerificationToken(email string) (string, error) {
 	// Define the token expiration time
 	expirationTime := time.Now().Add(24 * time.Hour)
 
-	// Create the JWT claims, which includes the email and expiry time
-	claims := &jwt.StandardClaims{
-		Subject:   email,
-		ExpiresAt: expirationTime.Unix(),
+	// Create the JWT claims, which includes the email, purpose and expiry time
+	claims := &VerificationClaims{
+		Purpose: TokenPurposeEmailVerification,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   email,
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
 	}
 
-	// Create the token using your secret key
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenString, err := signToken(claims)
 	if err != nil {
 		fmt.Println("Failed to generate token:", err)
 		return "", err
 	}
 
-	// Parse the token
-	decode := &jwt.StandardClaims{}
-	dctoken, err := jwt.ParseWithClaims(tokenString, decode, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
-
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			return "", err
-		}
-		return "", err
-	}
-
-	if !dctoken.Valid {
-		return "", err
-	}
-
-	// Get the email from the token claims
-	// email := decode.Subject
-	fmt.Println("Email:", decode.Subject)
-
 	return tokenString, nil
 }
 
 func SendWelcomeEmail(to string, verificationLink string) error {
-	// Parse the HTML template
-	tmpl, err := template.ParseFiles("templates/welcome_email.html")
-	if err != nil {
-		fmt.Println("Failed to parse template:", err)
-		return nil
-	}
-
 	// Data to pass to the template
 	data := struct {
 		Name             string
@@ -170,115 +205,172 @@ func SendWelcomeEmail(to string, verificationLink string) error {
 		VerificationLink: verificationLink,
 	}
 
+	body := "Thank you for registering with Porty!!!"
+	return sendTemplateEmail(to, "Welcome to Porty!!!", body, "templates/welcome_email.html", data)
+}
+
+// sendTemplateEmail renders the HTML template with data and queues it in the
+// outbox along with a plain text alternative
+func sendTemplateEmail(to, subject, plainBody, templatePath string, data interface{}) error {
+	// Parse the HTML template
+	tmpl, err := template.ParseFiles(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
 	// Execute the template with data
 	var body bytes.Buffer
 	if err := tmpl.Execute(&body, data); err != nil {
-		fmt.Println("Failed to execute template:", err)
-		return nil
+		return fmt.Errorf("failed to execute template: %w", err)
 	}
 
-	m := gomail.NewMessage()
-	m.SetHeader("From", os.Getenv("EMAIL_USERNAME"))
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", "Welcome to Porty!!!")
-	m.SetBody("text/plain", "Thank you for registering with Porty!!!")
-	m.SetBody("text/html", body.String())
-
-	d := gomail.NewDialer("smtp.gmail.com", 587, os.Getenv("EMAIL_USERNAME"), os.Getenv("EMAIL_PASSWORD"))
+	return EnqueueEmail(Email{
+		To:       to,
+		Subject:  subject,
+		TextBody: plainBody,
+		HTMLBody: body.String(),
+	})
+}
 
-	// Send the email
-	if err := d.DialAndSend(m); err != nil {
-		fmt.Println("Failed to send email:", err)
-		return nil
+// GetFrontendURL returns the frontend base URL of the current environment
+func GetFrontendURL() string {
+	_ = godotenv.Load()
+	if strings.ToLower(os.Getenv("WEB_SERVICE")) == "local" {
+		return os.Getenv("FRONT_END_URL_LOCAL")
 	}
-	return nil
+	return os.Getenv("FRONT_END_URL_SERVER")
 }
 
-func CreateOrUpdateOAuth(userInfo *oauth2api.Userinfo) (string, error) {
-	user, err := GetUserByEmail(userInfo.Email)
-	if err != nil && err != mongo.ErrNoDocuments {
+// CreateOrUpdateOAuth returns the user the provider account is linked to,
+// creating a new user for unknown accounts. Existing users are never linked
+// by email: they have to link the provider from their account, except users
+// created by the Google login before identities were stored.
+func CreateOrUpdateOAuth(identity OAuthIdentity) (models.User, error) {
+	now := time.Now()
+
+	user, err := repositories.GetUserByIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		if _, err := repositories.UpdateUserFields(user.ID, bson.M{"lastLogin": now}); err != nil {
+			log.Println("Error updating user:", err)
+			return models.User{}, err
+		}
+		user.LastLogin = &now
+		return user, nil
+	}
+	if err != mongo.ErrNoDocuments {
 		log.Println("Error checking if user exists:", err)
-		return "", err
+		return models.User{}, err
 	}
 
-	isCreted := user.ID.IsZero()
+	if identity.Email == "" || !identity.EmailVerified {
+		return models.User{}, ErrOAuthEmailRequired
+	}
 
-	if !isCreted {
-		now := time.Now()
-		if !user.IsVerify {
-			user.IsVerify = true
-		}
-		if user.VerifyAt == nil {
-			user.VerifyAt = &now
+	user, err = GetUserByEmail(identity.Email)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Println("Error checking if user exists:", err)
+		return models.User{}, err
+	}
+
+	if !user.ID.IsZero() {
+		if identity.Provider != OAuthProviderGoogle || !user.IsGoogle || len(user.Identities) > 0 {
+			return models.User{}, ErrOAuthAccountExists
 		}
-		if !user.IsGoogle {
-			user.IsGoogle = true
+		if err := addIdentity(user.ID, identity); err != nil {
+			log.Println("Error updating user:", err)
+			return models.User{}, err
 		}
-		user.LastLogin = &now
-		_, err := UpdateUserById(user.ID.Hex(), user)
-		if err != nil {
+		if _, err := repositories.UpdateUserFields(user.ID, bson.M{"lastLogin": now}); err != nil {
 			log.Println("Error updating user:", err)
-			return "", err
+			return models.User{}, err
 		}
+		user.LastLogin = &now
+		return user, nil
 	}
 
-	if isCreted {
-		now := time.Now()
-		user = models.User{
-			ID:        primitive.NewObjectID(),
-			FullName:  userInfo.Name,
-			Email:     userInfo.Email,
-			Password:  "",
-			IsVerify:  true,
-			VerifyAt:  &now,
-			IsGoogle:  true,
-			LastLogin: &now,
-			CreatedAt: time.Now(),
-			UpdatedAt: nil,
-		}
-
-		_, err := repositories.CreateUser(user)
-		if err != nil {
-			log.Println("Error creating user:", err)
-			return "", err
-		}
+	user = models.User{
+		ID:       primitive.NewObjectID(),
+		FullName: identity.Name,
+		Email:    identity.Email,
+		Password: "",
+		Role:     models.RoleUser,
+		IsVerify: true,
+		VerifyAt: &now,
+		IsGoogle: identity.Provider == OAuthProviderGoogle,
+		Identities: []models.LinkedIdentity{{
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+			LinkedAt: now,
+		}},
+		LastLogin: &now,
+		CreatedAt: now,
+		UpdatedAt: nil,
 	}
 
-	token, err := GenerateToken(user.ID.Hex(), user.Email, user.FullName)
-	if err != nil {
-		log.Println("Error generating token:", err)
-		return "", err
+	if _, err := repositories.CreateUser(user); err != nil {
+		log.Println("Error creating user:", err)
+		return models.User{}, err
 	}
-	return token, nil
+	return user, nil
 }
 
+// Token purposes keep tokens signed with the same keys from being used in
+// place of one another
+const (
+	TokenPurposeAccess            = "access"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeEmailChange       = "email_change"
+	TokenPurposeMFAPending        = "mfa_pending"
+)
+
 // CustomClaims defines the custom claims for the JWT token
 type CustomClaims struct {
 	FullName string `json:"FullName"`
 	UserId   string `json:"UserId"`
 	Email    string `json:"Email"`
-	jwt.StandardClaims
+	Role     string `json:"Role"`
+	Purpose  string `json:"Purpose"`
+	jwt.RegisteredClaims
 }
 
-// generateToken generates a JWT token with the user's ID, email, and full name
-func GenerateToken(userID, email, fullName string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// VerificationClaims defines the claims of email verification tokens. Email
+// change tokens carry the user ID as subject and the new email in Email.
+type VerificationClaims struct {
+	Purpose string `json:"Purpose"`
+	Email   string `json:"Email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IsAdmin reports whether the claims belong to an administrator
+func (c *CustomClaims) IsAdmin() bool {
+	return c.Role == models.RoleAdmin
+}
+
+// GenerateToken generates a JWT access token with the user's ID, email, full
+// name and role. The returned claims carry the token ID (jti) used for
+// revocation.
+func GenerateToken(user models.User) (string, *CustomClaims, error) {
+	now := time.Now()
+	expirationTime := now.Add(accessTokenTTL())
 	claims := &CustomClaims{
-		FullName: fullName,
-		UserId:   userID,
-		Email:    email,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-			IssuedAt:  time.Now().Unix(),
+		FullName: user.FullName,
+		UserId:   user.ID.Hex(),
+		Email:    user.Email,
+		Role:     user.GetRole(),
+		Purpose:  TokenPurposeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    "porty-go",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenString, err := signToken(claims)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return tokenString, nil
+	return tokenString, claims, nil
 }
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"porty-go/models"
+	"porty-go/repositories"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	VerificationPolicyAllow = "allow"
+	VerificationPolicyBlock = "block"
+	VerificationPolicyGrace = "grace"
+
+	defaultUnverifiedLoginGrace = 72 * time.Hour
+
+	verificationResendCooldown = time.Minute
+	verificationResendWindow   = 24 * time.Hour
+	verificationResendMax      = 5
+)
+
+var (
+	ErrEmailNotVerified      = errors.New("please verify your email before logging in")
+	ErrEmailChangeNotPending = errors.New("this email change is no longer pending")
+)
+
+// VerificationRateLimitError is returned when verification emails are
+// requested too often
+type VerificationRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *VerificationRateLimitError) Error() string {
+	return fmt.Sprintf("too many verification emails requested, try again in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
+
+// ResendVerificationEmail sends a new verification link. Unknown and already
+// verified emails are silently ignored so the endpoint cannot be used to find
+// accounts.
+func ResendVerificationEmail(email string) error {
+	user, err := GetUserByEmail(email)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	if user.IsVerify {
+		return nil
+	}
+
+	now := time.Now()
+	windowAt := user.VerificationWindowAt
+	count := user.VerificationSendCount
+	if windowAt == nil || now.Sub(*windowAt) >= verificationResendWindow {
+		windowAt = &now
+		count = 0
+	}
+
+	if user.VerificationSentAt != nil && now.Sub(*user.VerificationSentAt) < verificationResendCooldown {
+		return &VerificationRateLimitError{RetryAfter: verificationResendCooldown - now.Sub(*user.VerificationSentAt)}
+	}
+	if count >= verificationResendMax {
+		return &VerificationRateLimitError{RetryAfter: verificationResendWindow - now.Sub(*windowAt)}
+	}
+
+	_, err = repositories.UpdateUserFields(user.ID, bson.M{
+		"verificationSentAt":    now,
+		"verificationWindowAt":  *windowAt,
+		"verificationSendCount": count + 1,
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendVerificationEmail(user)
+}
+
+// CheckLoginVerification applies UNVERIFIED_LOGIN_POLICY to the user: allow
+// lets unverified accounts in, block refuses them and grace (the default)
+// refuses them once UNVERIFIED_LOGIN_GRACE has passed since registration
+func CheckLoginVerification(user models.User) error {
+	if user.IsVerify {
+		return nil
+	}
+
+	switch strings.ToLower(os.Getenv("UNVERIFIED_LOGIN_POLICY")) {
+	case VerificationPolicyAllow:
+		return nil
+	case VerificationPolicyBlock:
+		return ErrEmailNotVerified
+	default:
+		grace := durationFromEnv("UNVERIFIED_LOGIN_GRACE", defaultUnverifiedLoginGrace)
+		if time.Since(user.CreatedAt) > grace {
+			return ErrEmailNotVerified
+		}
+		return nil
+	}
+}
+
+// sendVerificationEmail queues the welcome email with a fresh verification link
+func sendVerificationEmail(user models.User) error {
+	token, err := GenerateVerificationToken(user.Email)
+	if err != nil {
+		log.Println("Error generating verification token:", err)
+		return errors.New("failed to generate verification token")
+	}
+
+	verificationLink := GetFrontendURL() + "/users/verify?token=" + token
+	return SendWelcomeEmail(user.Email, verificationLink)
+}
+
+// sendEmailChangeEmail sends the link confirming the new email to that address
+func sendEmailChangeEmail(user models.User, email string) error {
+	claims := &VerificationClaims{
+		Purpose: TokenPurposeEmailChange,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.Hex(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+		},
+	}
+	token, err := signToken(claims)
+	if err != nil {
+		log.Println("Error generating email change token:", err)
+		return errors.New("failed to generate email change token")
+	}
+
+	name := user.FullName
+	if name == "" {
+		name = email
+	}
+	data := struct {
+		Name             string
+		VerificationLink string
+	}{
+		Name:             name,
+		VerificationLink: GetFrontendURL() + "/users/verify?token=" + token,
+	}
+	body := "Confirm the new email of your Porty!!! account: " + data.VerificationLink
+	return sendTemplateEmail(email, "Confirm your new email", body, "templates/email_change_email.html", data)
+}
+
+// ConfirmEmailChange swaps the pending email of the user behind the token in
+// as their verified email
+func ConfirmEmailChange(claims *VerificationClaims) (models.User, error) {
+	userID, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil || claims.Email == "" {
+		return models.User{}, ErrEmailChangeNotPending
+	}
+
+	now := time.Now()
+	user, err := repositories.ConfirmPendingEmail(userID, claims.Email, bson.M{"VerifyAt": now, "updatedAt": now})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.User{}, ErrEmailTaken
+		}
+		if err == mongo.ErrNoDocuments {
+			return models.User{}, ErrEmailChangeNotPending
+		}
+		return models.User{}, err
+	}
+	return user, nil
+}
@@ -6,59 +6,159 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
-	"io"
+	"fmt"
+	"strings"
 )
 
-// Encrypt encrypts the given text using AES encryption
-func Encrypt(plainText, key string) (string, error) {
-	if len(key) != 16 {
-		return "", errors.New("key must be 16 bytes long")
+// envelopeV1 prefixes the values encrypted with AES-GCM. The base64 part holds
+// the length of the key ID, the key ID, the nonce and the sealed text; the
+// version and key ID are authenticated with the text.
+const envelopeV1 = "v1."
+
+var envelopeEncoding = base64.RawURLEncoding
+
+var (
+	ErrMalformedCiphertext = errors.New("ciphertext is malformed")
+	ErrTruncatedCiphertext = errors.New("ciphertext is truncated")
+	ErrTamperedCiphertext  = errors.New("ciphertext failed authentication")
+	ErrUnknownEncryptKey   = errors.New("ciphertext is encrypted with an unknown key")
+	ErrNoEncryptKey        = errors.New("no encryption key is configured")
+)
+
+// Keyring encrypts with its primary key and decrypts with any of its keys.
+// The legacy key decrypts the unauthenticated AES-CFB values written before
+// the envelope was introduced.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+	legacy  cipher.Block
+}
+
+// NewKeyring builds a keyring from AES keys of 16, 24 or 32 bytes by ID.
+// legacyKey may be nil, otherwise it is the 16 byte key of the CFB values.
+func NewKeyring(primary string, keys map[string][]byte, legacyKey []byte) (*Keyring, error) {
+	ring := &Keyring{primary: primary, keys: map[string]cipher.AEAD{}}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("key ID %q must have between 1 and 255 bytes", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		ring.keys[id] = aead
+	}
+	if _, ok := ring.keys[primary]; primary != "" && !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
 	}
 
-	block, err := aes.NewCipher([]byte(key))
-	if err != nil {
+	if legacyKey != nil {
+		if len(legacyKey) != 16 {
+			return nil, errors.New("legacy key must be 16 bytes long")
+		}
+		block, err := aes.NewCipher(legacyKey)
+		if err != nil {
+			return nil, err
+		}
+		ring.legacy = block
+	}
+	return ring, nil
+}
+
+// Encrypt seals the text with the primary key in a v1 envelope
+func (r *Keyring) Encrypt(plainText string) (string, error) {
+	aead, ok := r.keys[r.primary]
+	if !ok {
+		return "", ErrNoEncryptKey
+	}
+
+	header := append([]byte{byte(len(r.primary))}, r.primary...)
+	envelope := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(plainText)+aead.Overhead())
+	copy(envelope, header)
+	if _, err := rand.Read(envelope[len(header):]); err != nil {
 		return "", err
 	}
 
-	plainTextBytes := []byte(plainText)
+	nonce := envelope[len(header):]
+	envelope = aead.Seal(envelope, nonce, []byte(plainText), envelopeAdditionalData(r.primary))
+	return envelopeV1 + envelopeEncoding.EncodeToString(envelope), nil
+}
 
-	// Generate a new initialization vector (IV)
-	cipherText := make([]byte, aes.BlockSize+len(plainTextBytes))
-	iv := cipherText[:aes.BlockSize]
+// Decrypt opens a v1 envelope, or a legacy CFB value when the keyring has the
+// legacy key. Errors are ErrMalformedCiphertext, ErrTruncatedCiphertext,
+// ErrUnknownEncryptKey or ErrTamperedCiphertext.
+func (r *Keyring) Decrypt(encryptedText string) (string, error) {
+	encoded, ok := strings.CutPrefix(encryptedText, envelopeV1)
+	if !ok {
+		return r.decryptLegacy(encryptedText)
+	}
 
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return "", err
+	envelope, err := envelopeEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrMalformedCiphertext
 	}
+	if len(envelope) == 0 || len(envelope) < 1+int(envelope[0]) {
+		return "", ErrTruncatedCiphertext
+	}
+	id := string(envelope[1 : 1+int(envelope[0])])
+	envelope = envelope[1+len(id):]
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(cipherText[aes.BlockSize:], plainTextBytes)
+	aead, ok := r.keys[id]
+	if !ok {
+		return "", ErrUnknownEncryptKey
+	}
+	if len(envelope) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrTruncatedCiphertext
+	}
 
-	// Return the encrypted data as a base64 encoded string
-	return base64.StdEncoding.EncodeToString(cipherText), nil
+	nonce, sealed := envelope[:aead.NonceSize()], envelope[aead.NonceSize():]
+	plainText, err := aead.Open(nil, nonce, sealed, envelopeAdditionalData(id))
+	if err != nil {
+		return "", ErrTamperedCiphertext
+	}
+	return string(plainText), nil
 }
 
-// Decrypt decrypts the given text using AES encryption
-func Decrypt(encryptedText, key string) (string, error) {
-	if len(key) != 16 {
-		return "", errors.New("key must be 16 bytes long")
+// IsCurrent reports whether the value is a v1 envelope of the primary key, so
+// callers can re-encrypt the older ones they read
+func (r *Keyring) IsCurrent(encryptedText string) bool {
+	encoded, ok := strings.CutPrefix(encryptedText, envelopeV1)
+	if !ok {
+		return false
+	}
+	envelope, err := envelopeEncoding.DecodeString(encoded)
+	if err != nil || len(envelope) == 0 || len(envelope) < 1+int(envelope[0]) {
+		return false
 	}
+	return string(envelope[1:1+int(envelope[0])]) == r.primary
+}
 
-	block, err := aes.NewCipher([]byte(key))
-	if err != nil {
-		return "", err
+// decryptLegacy decrypts the base64 IV and AES-CFB text of the former Encrypt.
+// Those values are not authenticated, a wrong key or altered text decrypts to
+// garbage instead of failing.
+func (r *Keyring) decryptLegacy(encryptedText string) (string, error) {
+	if r.legacy == nil {
+		return "", ErrMalformedCiphertext
 	}
 
-	// Decode the base64 encoded string
 	cipherText, err := base64.StdEncoding.DecodeString(encryptedText)
 	if err != nil {
-		return "", err
+		return "", ErrMalformedCiphertext
+	}
+	if len(cipherText) < aes.BlockSize {
+		return "", ErrTruncatedCiphertext
 	}
 
 	iv := cipherText[:aes.BlockSize]
-	cipherText = cipherText[aes.BlockSize:]
-
-	stream := cipher.NewCFBDecrypter(block, iv)
-	stream.XORKeyStream(cipherText, cipherText)
+	plainText := make([]byte, len(cipherText)-aes.BlockSize)
+	cipher.NewCFBDecrypter(r.legacy, iv).XORKeyStream(plainText, cipherText[aes.BlockSize:])
+	return string(plainText), nil
+}
 
-	return string(cipherText), nil
+func envelopeAdditionalData(id string) []byte {
+	return []byte(envelopeV1 + id)
 }
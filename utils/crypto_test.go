@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+var (
+	testLegacyKey = []byte("0123456789abcdef")
+	testOldKey    = bytes.Repeat([]byte{1}, 32)
+	testNewKey    = bytes.Repeat([]byte{2}, 32)
+)
+
+func testKeyring(t testing.TB) *Keyring {
+	t.Helper()
+	ring, err := NewKeyring("new", map[string][]byte{"old": testOldKey, "new": testNewKey}, testLegacyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+// legacyEncrypt writes a value the way the former AES-CFB Encrypt did
+func legacyEncrypt(t testing.TB, plainText string) string {
+	t.Helper()
+	block, err := aes.NewCipher(testLegacyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipherText := make([]byte, aes.BlockSize+len(plainText))
+	copy(cipherText, "fixed-test-iv-16")
+	cipher.NewCFBEncrypter(block, cipherText[:aes.BlockSize]).XORKeyStream(cipherText[aes.BlockSize:], []byte(plainText))
+	return base64.StdEncoding.EncodeToString(cipherText)
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	ring := testKeyring(t)
+	old, err := NewKeyring("old", map[string][]byte{"old": testOldKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := ring.Encrypt("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := old.Encrypt("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, value := range map[string]string{"current": current, "rotated": rotated, "legacy": legacyEncrypt(t, "JBSWY3DPEHPK3PXP")} {
+		plainText, err := ring.Decrypt(value)
+		if err != nil || plainText != "JBSWY3DPEHPK3PXP" {
+			t.Errorf("%s: Decrypt = %q, %v", name, plainText, err)
+		}
+	}
+
+	if !ring.IsCurrent(current) || ring.IsCurrent(rotated) || ring.IsCurrent(legacyEncrypt(t, "x")) {
+		t.Error("IsCurrent only reports envelopes of the primary key")
+	}
+}
+
+func TestKeyringDecryptErrors(t *testing.T) {
+	ring := testKeyring(t)
+	valid, err := ring.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewKeyring("other", map[string][]byte{"other": testOldKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := other.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := []byte(valid)
+	tampered[len(tampered)-2] ^= 1
+
+	tests := []struct {
+		name  string
+		value string
+		want  error
+	}{
+		{"not base64", "v1.***", ErrMalformedCiphertext},
+		{"empty envelope", "v1.", ErrTruncatedCiphertext},
+		{"truncated", valid[:len(valid)-20], ErrTruncatedCiphertext},
+		{"tampered", string(tampered), ErrTamperedCiphertext},
+		{"unknown key", unknown, ErrUnknownEncryptKey},
+		{"short legacy", base64.StdEncoding.EncodeToString([]byte("short")), ErrTruncatedCiphertext},
+	}
+	for _, test := range tests {
+		if _, err := ring.Decrypt(test.value); !errors.Is(err, test.want) {
+			t.Errorf("%s: Decrypt error = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+// FuzzKeyringDecrypt feeds arbitrary input to the decode path, which must
+// never panic and only fail with the typed errors
+func FuzzKeyringDecrypt(f *testing.F) {
+	ring := testKeyring(f)
+	valid, err := ring.Encrypt("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		f.Fatal(err)
+	}
+	other, err := NewKeyring("other", map[string][]byte{"other": testOldKey}, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+	unknown, err := other.Encrypt("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		f.Fatal(err)
+	}
+	tampered := []byte(valid)
+	tampered[len(tampered)-2] ^= 1
+
+	f.Add(valid)
+	f.Add(valid[:len(valid)-10])
+	f.Add(string(tampered))
+	f.Add(unknown)
+	f.Add(legacyEncrypt(f, "JBSWY3DPEHPK3PXP"))
+	f.Add("v1.")
+	f.Add("v1.AA")
+	f.Add("")
+
+	typed := []error{ErrMalformedCiphertext, ErrTruncatedCiphertext, ErrTamperedCiphertext, ErrUnknownEncryptKey}
+	f.Fuzz(func(t *testing.T, value string) {
+		ring.IsCurrent(value)
+
+		_, err := ring.Decrypt(value)
+		if err == nil {
+			return
+		}
+		for _, want := range typed {
+			if errors.Is(err, want) {
+				return
+			}
+		}
+		t.Fatalf("Decrypt(%q) returned an untyped error: %v", value, err)
+	})
+}